@@ -0,0 +1,83 @@
+package jsonrpc2
+
+// Policy is an authorization policy which defines which clients may call
+// which methods.
+//
+// Call is allowed if at least one rule allows it, all other calls are
+// denied.
+type Policy struct {
+	Rules []Rule
+	// Deny is an error returned for denied calls. By default it's same
+	// error as returned for unknown method (code -32601), to not leak
+	// information about existing methods.
+	Deny *Error
+}
+
+// Rule allows calling any of Methods by clients which match any of
+// Principals or Roles.
+type Rule struct {
+	// Methods is a list of path.Match patterns like "Svc.*".
+	Methods []string
+	// Principals is a list of Principal names. Use "*" to match any
+	// authenticated client.
+	Principals []string
+	// Roles is a list of Principal roles.
+	Roles []string
+}
+
+// Allowed returns true if policy allows client p (nil for
+// unauthenticated client) to call method.
+func (policy *Policy) Allowed(p *Principal, method string) bool {
+	for _, rule := range policy.Rules {
+		if matchMethod(rule.Methods, method) && rule.allows(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns true if rule allows client p to call it's methods.
+func (rule *Rule) allows(p *Principal) bool {
+	if len(rule.Principals) == 0 && len(rule.Roles) == 0 {
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	for _, name := range rule.Principals {
+		if name == "*" || name == p.Name {
+			return true
+		}
+	}
+	for _, role := range rule.Roles {
+		for _, r := range p.Roles {
+			if role == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize replies with error and returns errHandled if current
+// request isn't allowed by policy.
+func (c *serverCodec) authorize() error {
+	if c.o.policy == nil || c.req.Method == batchMethod {
+		return nil
+	}
+	p := PrincipalFromContext(c.ctx)
+	if c.o.policy.Allowed(p, c.req.Method) {
+		return nil
+	}
+	name := ""
+	if p != nil {
+		name = p.Name
+	}
+	c.o.logger.Warn("call denied", "method", c.req.Method, "principal", name)
+	err := c.o.policy.Deny
+	if err == nil {
+		err = NewError(errMethod.Code, "rpc: can't find method "+c.req.Method)
+	}
+	c.respond(nil, err)
+	return errHandled
+}
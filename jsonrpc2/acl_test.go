@@ -0,0 +1,111 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	policy := jsonrpc2.Policy{Rules: []jsonrpc2.Rule{
+		{Methods: []string{"Public.*"}},
+		{Methods: []string{"User.*"}, Principals: []string{"*"}},
+		{Methods: []string{"Admin.*", "User.Delete"}, Roles: []string{"admin"}},
+		{Methods: []string{"Bob.Get"}, Principals: []string{"bob"}},
+	}}
+	alice := &jsonrpc2.Principal{Name: "alice", Roles: []string{"admin"}}
+	bob := &jsonrpc2.Principal{Name: "bob", Roles: []string{"user"}}
+	cases := []struct {
+		p      *jsonrpc2.Principal
+		method string
+		want   bool
+	}{
+		{nil, "Public.Get", true},
+		{nil, "User.Get", false},
+		{bob, "User.Get", true},
+		{bob, "User.Delete", true},
+		{bob, "Admin.Get", false},
+		{alice, "Admin.Get", true},
+		{bob, "Bob.Get", true},
+		{alice, "Bob.Get", false},
+		{alice, "Other.Get", false},
+	}
+	for _, c := range cases {
+		if got := policy.Allowed(c.p, c.method); got != c.want {
+			t.Errorf("Allowed(%v, %q) = %v, want %v", c.p, c.method, got, c.want)
+		}
+	}
+}
+
+func TestPolicyStream(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&AuthSvc{})
+	dial := func(opts ...jsonrpc2.Option) *jsonrpc2.Client {
+		cli, conn := net.Pipe()
+		go srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv, opts...))
+		return jsonrpc2.NewClient(cli)
+	}
+	policy := jsonrpc2.Policy{Rules: []jsonrpc2.Rule{{Methods: []string{"Public.*"}}}}
+
+	client := dial(jsonrpc2.WithPolicy(policy))
+	defer client.Close()
+	plain := dial()
+	defer plain.Close()
+	errDenied := client.Call("AuthSvc.Whoami", nil, nil)
+	errMissing := plain.Call("AuthSvc.Missing", nil, nil)
+	if errDenied == nil || errMissing == nil {
+		t.Fatalf("errDenied = %v, errMissing = %v", errDenied, errMissing)
+	}
+	want := strings.Replace(errMissing.Error(), "Missing", "Whoami", 1)
+	if errDenied.Error() != want {
+		t.Errorf("errDenied = %v, want %v", errDenied, want)
+	}
+
+	policy.Deny = jsonrpc2.NewError(-32043, "denied")
+	client2 := dial(jsonrpc2.WithPolicy(policy))
+	defer client2.Close()
+	err := client2.Call("AuthSvc.Whoami", nil, nil)
+	if err == nil || err.Error() != `{"code":-32043,"message":"denied"}` {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestPolicyHTTPBatch(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&AuthSvc{})
+	policy := jsonrpc2.Policy{
+		Rules: []jsonrpc2.Rule{{Methods: []string{"AuthSvc.Whoami"}, Roles: []string{"admin"}}},
+		Deny:  jsonrpc2.NewError(-32043, "denied"),
+	}
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv,
+		jsonrpc2.WithAuthenticator(tokenAuth), jsonrpc2.WithPolicy(policy)))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(`[`+
+		`{"jsonrpc":"2.0","id":1,"method":"AuthSvc.Whoami"},`+
+		`{"jsonrpc":"2.0","id":2,"method":"AuthSvc.Missing"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"jsonrpc":"2.0","id":1,"result":"alice"},` +
+		`{"jsonrpc":"2.0","id":2,"error":{"code":-32043,"message":"denied"}}]`
+	if got := strings.TrimSpace(string(buf)); got != want {
+		t.Errorf("\nwant: %s\ngot:  %s", want, got)
+	}
+}
@@ -0,0 +1,195 @@
+package jsonrpc2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AuthenticateMethod is a name of method which should be called by
+// client as a first call on stream transport (like TCP) to authenticate
+// on server which uses WithAuthenticator option.
+//
+// Params are provided to Authenticator as Credentials.Params, result
+// is true on success. On failure server replies with error and closes
+// connection.
+const AuthenticateMethod = "rpc.authenticate"
+
+var errUnauthenticated = NewError(-32010, "unauthenticated") //nolint:gochecknoglobals
+
+// Principal identifies authenticated client.
+type Principal struct {
+	Name  string
+	Roles []string
+	Data  any // Any extra details provided by Authenticator.
+}
+
+// Credentials contains everything known about client which may be used
+// to authenticate it.
+type Credentials struct {
+	// HTTPRequest is set for HTTP transport.
+	HTTPRequest *http.Request
+	// TLS is set for TLS connections.
+	TLS *tls.ConnectionState
+	// RemoteAddr is set if it's known for connection.
+	RemoteAddr string
+	// Params is set for AuthenticateMethod call on stream transport.
+	Params json.RawMessage
+}
+
+// Authenticator authenticates client using given credentials.
+//
+// It's called by HTTP handler for each HTTP request and by server codec
+// on stream transport for AuthenticateMethod call or (if client starts
+// with another call) just once using TLS identity.
+//
+// If returned error is *Error then it'll be sent to client, otherwise
+// client will get error with code -32010.
+type Authenticator func(ctx context.Context, creds *Credentials) (*Principal, error)
+
+// ContextWithPrincipal returns a copy of ctx with p.
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey, p)
+}
+
+// PrincipalFromContext returns principal of authenticated client or nil.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey).(*Principal)
+	return p
+}
+
+// BearerToken returns token from HTTP header "Authorization: Bearer" or
+// from "token" member of AuthenticateMethod params.
+func (c *Credentials) BearerToken() (string, bool) {
+	if c.HTTPRequest != nil {
+		const prefix = "bearer "
+		auth := c.HTTPRequest.Header.Get("Authorization")
+		if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+			return auth[len(prefix):], true
+		}
+		return "", false
+	}
+	var params struct {
+		Token string `json:"token"`
+	}
+	if json.Unmarshal(c.Params, &params) != nil || params.Token == "" {
+		return "", false
+	}
+	return params.Token, true
+}
+
+// BasicAuth returns username and password from HTTP header
+// "Authorization: Basic" or from "username" and "password" members of
+// AuthenticateMethod params.
+func (c *Credentials) BasicAuth() (username, password string, ok bool) {
+	if c.HTTPRequest != nil {
+		return c.HTTPRequest.BasicAuth()
+	}
+	var params struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if json.Unmarshal(c.Params, &params) != nil || params.Username == "" {
+		return "", "", false
+	}
+	return params.Username, params.Password, true
+}
+
+// PeerCertificate returns client's TLS certificate or nil.
+func (c *Credentials) PeerCertificate() *x509.Certificate {
+	if c.TLS == nil || len(c.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return c.TLS.PeerCertificates[0]
+}
+
+// authError returns error returned by Authenticator as *Error.
+func authError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return errUnauthenticated
+}
+
+// connCredentials returns credentials for stream connection.
+func connCredentials(conn interface{}) *Credentials {
+	creds := &Credentials{}
+	if c, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		state := c.ConnectionState()
+		creds.TLS = &state
+	}
+	if c, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		creds.RemoteAddr = c.RemoteAddr().String()
+	}
+	return creds
+}
+
+// authenticate returns error if current request should be rejected
+// because client isn't authenticated.
+//
+// It also handles AuthenticateMethod call, in this case it returns
+// errHandled or error to close connection.
+func (c *serverCodec) authenticate() error {
+	if c.o.authenticator == nil || PrincipalFromContext(c.ctx) != nil {
+		return nil
+	}
+
+	creds := connCredentials(c.c)
+	if c.req.Method == AuthenticateMethod {
+		if c.req.Params != nil {
+			creds.Params = *c.req.Params
+		}
+		p, err := c.o.authenticator(c.ctx, creds)
+		if err != nil {
+			c.o.logger.Warn("authentication failed", "remote", creds.RemoteAddr, "err", err)
+			c.respond(nil, authError(err))
+			return err
+		}
+		c.setPrincipal(p)
+		c.respond(true, nil)
+		return errHandled
+	}
+
+	if !c.authTried {
+		c.authTried = true
+		if creds.TLS != nil {
+			if p, err := c.o.authenticator(c.ctx, creds); err == nil {
+				c.setPrincipal(p)
+				return nil
+			}
+		}
+	}
+	c.respond(nil, errUnauthenticated)
+	return errHandled
+}
+
+func (c *serverCodec) setPrincipal(p *Principal) {
+	if p == nil {
+		p = &Principal{}
+	}
+	c.ctx = ContextWithPrincipal(c.ctx, p)
+}
+
+// authenticateHTTP returns context with principal or error if client
+// isn't authenticated.
+func (h *httpHandler) authenticateHTTP(ctx context.Context, req *http.Request) (context.Context, *Error) {
+	if h.o.authenticator == nil {
+		return ctx, nil
+	}
+	creds := &Credentials{HTTPRequest: req, TLS: req.TLS, RemoteAddr: req.RemoteAddr}
+	p, err := h.o.authenticator(req.Context(), creds)
+	if err != nil {
+		h.o.logger.Warn("authentication failed", "remote", req.RemoteAddr, "err", err)
+		return ctx, authError(err)
+	}
+	if p == nil {
+		p = &Principal{}
+	}
+	return ContextWithPrincipal(ctx, p), nil
+}
@@ -0,0 +1,127 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// AuthSvc is an RPC service for testing.
+type AuthSvc struct{}
+
+type AuthArg struct{ jsonrpc2.Ctx }
+
+// Whoami returns name of authenticated client.
+func (*AuthSvc) Whoami(arg AuthArg, res *string) error {
+	p := jsonrpc2.PrincipalFromContext(arg.Context())
+	if p == nil {
+		return errors.New("no principal")
+	}
+	*res = p.Name
+	return nil
+}
+
+func tokenAuth(_ context.Context, creds *jsonrpc2.Credentials) (*jsonrpc2.Principal, error) {
+	token, ok := creds.BearerToken()
+	switch {
+	case !ok:
+		return nil, errors.New("no token")
+	case token == "forbidden":
+		return nil, jsonrpc2.NewError(-32042, "forbidden")
+	case token != "secret":
+		return nil, errors.New("bad token")
+	}
+	return &jsonrpc2.Principal{Name: "alice", Roles: []string{"admin"}}, nil
+}
+
+func TestAuthHTTP(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&AuthSvc{})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv, jsonrpc2.WithAuthenticator(tokenAuth)))
+	defer ts.Close()
+
+	for _, c := range []struct {
+		token   string
+		wantErr string
+	}{
+		{"", `{"code":-32010,"message":"unauthenticated"}`},
+		{"bad", `{"code":-32010,"message":"unauthenticated"}`},
+		{"forbidden", `{"code":-32042,"message":"forbidden"}`},
+		{"secret", ""},
+	} {
+		client := jsonrpc2.NewCustomHTTPClient(ts.URL, jsonrpc2.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if c.token != "" {
+				req.Header.Set("Authorization", "Bearer "+c.token)
+			}
+			return http.DefaultClient.Do(req)
+		}))
+		var name string
+		err := client.Call("AuthSvc.Whoami", nil, &name)
+		if c.wantErr == "" {
+			if err != nil || name != "alice" {
+				t.Errorf("token %q: Whoami() = %q, %v", c.token, name, err)
+			}
+		} else if err == nil || err.Error() != c.wantErr {
+			t.Errorf("token %q: err = %v, want %s", c.token, err, c.wantErr)
+		}
+		client.Close()
+	}
+
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"AuthSvc.Whoami"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestAuthStream(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&AuthSvc{})
+	dial := func() *jsonrpc2.Client {
+		cli, conn := net.Pipe()
+		go srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv, jsonrpc2.WithAuthenticator(tokenAuth)))
+		return jsonrpc2.NewClient(cli)
+	}
+
+	client := dial()
+	defer client.Close()
+	var name string
+	err := client.Call("AuthSvc.Whoami", nil, &name)
+	if err == nil || err.Error() != `{"code":-32010,"message":"unauthenticated"}` {
+		t.Errorf("before auth: err = %v", err)
+	}
+	var ok bool
+	err = client.Call(jsonrpc2.AuthenticateMethod, map[string]string{"token": "secret"}, &ok)
+	if err != nil || !ok {
+		t.Fatalf("auth: %v, %v", ok, err)
+	}
+	err = client.Call("AuthSvc.Whoami", nil, &name)
+	if err != nil || name != "alice" {
+		t.Errorf("after auth: Whoami() = %q, %v", name, err)
+	}
+
+	client2 := dial()
+	defer client2.Close()
+	err = client2.Call(jsonrpc2.AuthenticateMethod, map[string]string{"token": "bad"}, &ok)
+	if err == nil || err.Error() != `{"code":-32010,"message":"unauthenticated"}` {
+		t.Errorf("bad auth: err = %v", err)
+	}
+	err = client2.Call("AuthSvc.Whoami", nil, &name)
+	if err == nil {
+		t.Errorf("after bad auth: Whoami() = %q, want connection closed", name)
+	}
+}
@@ -0,0 +1,36 @@
+package jsonrpc2
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes exponential backoff with optional jitter.
+//
+// Zero values of Min, Max and Factor are replaced with defaults:
+// 100ms, 10s and 2.
+type Backoff struct {
+	Min    time.Duration // Delay before first attempt.
+	Max    time.Duration // Maximum delay.
+	Factor float64       // Multiplier applied to delay after each attempt.
+	Jitter float64       // Randomize delay by up to ±Jitter*delay (0..1).
+}
+
+// Delay returns delay before given attempt (starting from 0).
+func (b Backoff) Delay(attempt int) time.Duration {
+	if b.Min <= 0 {
+		b.Min = 100 * time.Millisecond
+	}
+	if b.Max <= 0 {
+		b.Max = 10 * time.Second
+	}
+	if b.Factor < 1 {
+		b.Factor = 2
+	}
+	d := math.Min(float64(b.Min)*math.Pow(b.Factor, float64(attempt)), float64(b.Max))
+	if b.Jitter > 0 {
+		d += d * math.Min(b.Jitter, 1) * (2*rand.Float64() - 1) //nolint:gosec // Not a security issue.
+	}
+	return time.Duration(d)
+}
@@ -1,63 +1,166 @@
 package jsonrpc2
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"net"
 	"net/rpc"
+	"sync"
 )
 
 var jErrRequest = json.RawMessage(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`) //nolint:gochecknoglobals
 
+var errBatchTimeout = NewError(-32000, "batch timeout") //nolint:gochecknoglobals
+
 // JSONRPC2 is an internal RPC service used to process batch requests.
 type JSONRPC2 struct{}
 
 // BatchArg is a param for internal RPC JSONRPC2.Batch.
 type BatchArg struct {
 	srv  *rpc.Server
+	o    *options
 	reqs []*json.RawMessage
 	Ctx
 }
 
 // Batch is an internal RPC method used to process batch requests.
-func (JSONRPC2) Batch(arg BatchArg, replies *[]*json.RawMessage) (err error) {
-	cli, srv := net.Pipe()
-	defer logIfFail(cli.Close)
-	go arg.srv.ServeCodec(NewServerCodecContext(arg.Context(), srv, arg.srv))
-
-	replyc := make(chan *json.RawMessage, len(arg.reqs))
-	donec := make(chan struct{}, 1)
+//
+// Requests are processed concurrently (see WithBatchParallelism) and
+// replies are returned in same order as requests.
+func (JSONRPC2) Batch(arg BatchArg, replies *[]*json.RawMessage) error {
+	if arg.o == nil {
+		arg.o = newOptions(nil)
+	}
+	if arg.o.metrics != nil {
+		arg.o.metrics.BatchSize(len(arg.reqs))
+	}
+	ctx := arg.Context()
+	var expire <-chan struct{}
+	if arg.o.batchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, arg.o.batchTimeout)
+		defer cancel()
+		expire = ctx.Done()
+	}
+	parallelism := arg.o.batchParallelism
+	if parallelism <= 0 || parallelism > len(arg.reqs) {
+		parallelism = len(arg.reqs)
+	}
 
+	var (
+		mu       sync.Mutex                                // protects results, served, expired
+		results  = make([]*json.RawMessage, len(arg.reqs)) // nil for notifications
+		served   = make([]bool, len(arg.reqs))
+		expired  bool
+		slots    = make(chan struct{}, parallelism)
+		finished = make(chan struct{})
+	)
+	for i, req := range arg.reqs {
+		if !isBatchRequest(req) {
+			results[i], served[i] = &jErrRequest, true
+		}
+	}
 	go func() {
-		dec := json.NewDecoder(cli)
-		*replies = make([]*json.RawMessage, 0, len(arg.reqs))
-		for reply := range replyc {
-			if reply != nil {
-				*replies = append(*replies, reply)
-			} else {
-				*replies = append(*replies, new(json.RawMessage))
-				if dec.Decode((*replies)[len(*replies)-1]) != nil {
-					(*replies)[len(*replies)-1] = &jErrRequest
-				}
+		var wg sync.WaitGroup
+		defer close(finished)
+		defer wg.Wait()
+		for i, req := range arg.reqs {
+			if !isBatchRequest(req) {
+				continue
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-expire:
+				return
 			}
+			// Select picks random case if both are ready, so batch may be
+			// already expired. Checked under mu to not start request after
+			// timeout replies were made.
+			mu.Lock()
+			select {
+			case <-expire:
+				mu.Unlock()
+				return
+			default:
+			}
+			wg.Add(1)
+			go func(i int, req json.RawMessage) {
+				defer wg.Done()
+				reply := serveBatchRequest(ctx, arg.srv, arg.o, req)
+				<-slots
+				mu.Lock()
+				if !expired {
+					results[i], served[i] = reply, true
+				}
+				mu.Unlock()
+			}(i, *req)
+			mu.Unlock()
 		}
-		donec <- struct{}{}
 	}()
+	select {
+	case <-finished:
+	case <-expire:
+	}
 
-	var testreq serverRequest
-	for _, req := range arg.reqs {
-		if req == nil || json.Unmarshal(*req, &testreq) != nil {
-			replyc <- &jErrRequest
-		} else {
-			if testreq.ID != nil {
-				replyc <- nil
-			}
-			if _, err = cli.Write(append(*req, '\n')); err != nil {
-				break
-			}
+	mu.Lock()
+	defer mu.Unlock()
+	expired = true
+	*replies = make([]*json.RawMessage, 0, len(arg.reqs))
+	for i := range arg.reqs {
+		if !served[i] {
+			results[i] = batchTimeoutReply(*arg.reqs[i], arg.o)
 		}
+		if results[i] != nil {
+			*replies = append(*replies, results[i])
+		}
+	}
+	return nil
+}
+
+// isBatchRequest returns false if req can't be a request (e.g. null or
+// nested batch).
+func isBatchRequest(req *json.RawMessage) bool {
+	return req != nil && len(*req) != 0 && (*req)[0] != '['
+}
+
+// serveBatchRequest processes single request from batch and returns
+// reply or nil if there is no reply (for notification).
+func serveBatchRequest(ctx context.Context, srv *rpc.Server, o *options, req json.RawMessage) *json.RawMessage {
+	var conn batchConn
+	if parent := ResponseMetadataFromContext(ctx); parent != nil {
+		m := newResponseMetadata(true)
+		ctx = context.WithValue(ctx, responseMetadataContextKey, m)
+		defer parent.merge(m)
+	}
+	serveRequest(srv, newBatchCodec(ctx, &conn, srv, o, req))
+	if conn.Len() == 0 {
+		return nil
 	}
+	reply := json.RawMessage(bytes.TrimRight(conn.Bytes(), "\n"))
+	return &reply
+}
 
-	close(replyc)
-	<-donec
-	return err
+// batchTimeoutReply returns reply for request from batch which wasn't
+// processed in time or nil if there is no reply (for notification).
+func batchTimeoutReply(req json.RawMessage, o *options) *json.RawMessage {
+	r := serverRequest{metaMember: o.metaMember}
+	if json.Unmarshal(req, &r) != nil {
+		return &jErrRequest
+	}
+	if r.ID == nil {
+		return nil
+	}
+	buf, err := json.Marshal(serverResponse{Version: protoVer, ID: r.ID, Error: errBatchTimeout})
+	if err != nil {
+		return &jErrRequest
+	}
+	reply := json.RawMessage(buf)
+	return &reply
 }
+
+// batchConn collects reply for single request from batch.
+type batchConn struct {
+	bytes.Buffer
+}
+
+func (*batchConn) Close() error { return nil }
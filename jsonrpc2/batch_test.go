@@ -0,0 +1,92 @@
+// nolint:errcheck
+package jsonrpc2
+
+import (
+	"bufio"
+	"net"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBatch(t *testing.T, srv *rpc.Server, in, want string, opts ...Option) {
+	t.Helper()
+	cli, conn := net.Pipe()
+	defer cli.Close()
+	go srv.ServeCodec(NewServerCodec(conn, srv, opts...))
+	go cli.Write([]byte(in + "\n"))
+	got, err := bufio.NewReader(cli).ReadString('\n')
+	if err != nil {
+		t.Fatalf("recv err = %v", err)
+	}
+	if got = strings.TrimRight(got, "\n"); got != want {
+		t.Errorf("\nsent: %#q\nwant: %#q\nrecv: %#q", in, want, got)
+	}
+}
+
+func TestBatchOrder(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&SlowSvc{})
+	testBatch(t, srv,
+		`[{"jsonrpc":"2.0","id":1,"method":"SlowSvc.Sleep","params":[20]},`+
+			`{"jsonrpc":"2.0","method":"SlowSvc.Sleep","params":[0]},`+
+			`1,`+
+			`[{"jsonrpc":"2.0","id":2,"method":"SlowSvc.Sleep","params":[0]}],`+
+			`{"jsonrpc":"2.0","id":3,"method":"SlowSvc.Sleep","params":[0]}]`,
+		`[{"jsonrpc":"2.0","id":1,"result":20},`+
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}},`+
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}},`+
+			`{"jsonrpc":"2.0","id":3,"result":0}]`)
+}
+
+func TestBatchParallelism(t *testing.T) {
+	req := `{"jsonrpc":"2.0","method":"SlowSvc.Wait","params":{}}`
+	batch := "[" + strings.Repeat(req+",", 7) + `{"jsonrpc":"2.0","id":0,"method":"SlowSvc.Wait","params":{}}]`
+	for _, c := range []struct {
+		opt  Option
+		want int
+	}{
+		{WithBatchParallelism(3), 3},
+		{WithSequentialBatch(), 1},
+	} {
+		svc := &SlowSvc{}
+		srv := rpc.NewServer()
+		srv.Register(svc)
+		testBatch(t, srv, batch, `[{"jsonrpc":"2.0","id":0,"result":{}}]`, c.opt)
+		if svc.maxInFlight != c.want {
+			t.Errorf("maxInFlight = %d, want %d", svc.maxInFlight, c.want)
+		}
+	}
+}
+
+func TestBatchTimeout(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&SlowSvc{})
+	start := time.Now()
+	testBatch(t, srv,
+		`[{"jsonrpc":"2.0","id":1,"method":"SlowSvc.Sleep","params":[0]},`+
+			`{"jsonrpc":"2.0","id":2,"method":"SlowSvc.Sleep","params":[1000]},`+
+			`{"jsonrpc":"2.0","method":"SlowSvc.Sleep","params":[1000]},`+
+			`{"jsonrpc":"2.0","id":3,"method":"SlowSvc.Sleep","params":[0]}]`,
+		`[{"jsonrpc":"2.0","id":1,"result":0},`+
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"batch timeout"}},`+
+			`{"jsonrpc":"2.0","id":3,"error":{"code":-32000,"message":"batch timeout"}}]`,
+		WithSequentialBatch(), WithBatchTimeout(50*time.Millisecond))
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("batch took %v", d)
+	}
+}
+
+func TestBatchTimeoutInvalid(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&SlowSvc{})
+	testBatch(t, srv,
+		`[{"jsonrpc":"2.0","id":1,"method":"SlowSvc.Sleep","params":[200]},`+
+			`{"jsonrpc":"2.0","id":2,"method":"SlowSvc.Sleep","params":[200]},`+
+			`null]`,
+		`[{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"batch timeout"}},`+
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"batch timeout"}},`+
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}]`,
+		WithSequentialBatch(), WithBatchTimeout(20*time.Millisecond))
+}
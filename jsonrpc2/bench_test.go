@@ -3,11 +3,14 @@
 package jsonrpc2_test
 
 import (
+	"bufio"
 	"io"
 	"net"
 	"net/http/httptest"
 	"net/rpc"
 	"net/rpc/jsonrpc"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/powerman/rpc-codec/jsonrpc2"
@@ -126,3 +129,25 @@ func BenchmarkGOBRPC_http(b *testing.B) {
 	defer client.Close()
 	benchmarkRPC(b, client)
 }
+
+func BenchmarkJSONRPC2_batch(b *testing.B) {
+	req := `{"jsonrpc":"2.0","id":1,"method":"Svc.Sum","params":[3,5]}`
+	for _, n := range []int{1, 10, 100} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			cli, srv := net.Pipe()
+			go jsonrpc2.ServeConn(srv)
+			defer cli.Close()
+			batch := []byte("[" + strings.Repeat(req+",", n-1) + req + "]\n")
+			r := bufio.NewReader(cli)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := cli.Write(batch); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := r.ReadBytes('\n'); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
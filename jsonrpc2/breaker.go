@@ -0,0 +1,145 @@
+package jsonrpc2
+
+import (
+	"context"
+	"io"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+)
+
+var errBreakerOpen = NewError(-32030, "circuit breaker is open") //nolint:gochecknoglobals
+
+// BreakerPolicy describes when client's circuit breaker opens.
+//
+// Client has separate circuit for each method. Circuit opens after
+// Threshold consecutive failed calls, while it's open calls fail
+// immediately with *Error (code -32030), which isn't retried by default
+// RetryPolicy. After Cooldown circuit allows
+// one probe call: if it succeeds then circuit closes, otherwise it
+// opens for next Cooldown.
+//
+// Only calls made using Call and CallContext are checked by breaker.
+type BreakerPolicy struct {
+	// Threshold is amount of consecutive failures which opens circuit
+	// (5 by default).
+	Threshold int
+	// Cooldown is how long circuit stays open before probe call
+	// (10s by default).
+	Cooldown time.Duration
+	// Failure reports is call failed with given error should be counted
+	// as a failure.
+	//
+	// Default is to count transport errors and timeouts: rpc.ErrShutdown,
+	// io.ErrUnexpectedEOF, context.DeadlineExceeded and *Error with
+	// code -32603.
+	Failure func(err error) bool
+}
+
+func (p *BreakerPolicy) failure(err error) bool {
+	if err == nil || err == context.Canceled {
+		return false
+	}
+	if p.Failure != nil {
+		return p.Failure(err)
+	}
+	switch err {
+	case rpc.ErrShutdown, io.ErrUnexpectedEOF, context.DeadlineExceeded:
+		return true
+	}
+	e, errNotRPC := serverError(err)
+	return errNotRPC == nil && e.Code == errInternal.Code
+}
+
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	policy    *BreakerPolicy
+
+	mu       sync.Mutex // protects circuits
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	until    time.Time // circuit is open until this time
+	probing  bool
+}
+
+func newBreaker(policy *BreakerPolicy) *breaker {
+	if policy == nil {
+		return nil
+	}
+	b := &breaker{
+		threshold: policy.Threshold,
+		cooldown:  policy.Cooldown,
+		policy:    policy,
+		circuits:  make(map[string]*circuit),
+	}
+	if b.threshold <= 0 {
+		b.threshold = defaultBreakerThreshold
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+	return b
+}
+
+func (b *breaker) circuit(method string) *circuit {
+	c := b.circuits[method]
+	if c == nil {
+		c = &circuit{}
+		b.circuits[method] = c
+	}
+	return c
+}
+
+// isOpen returns true if call to method will fail immediately.
+func (b *breaker) isOpen(method string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(method)
+	return c.failures >= b.threshold && (c.probing || time.Now().Before(c.until))
+}
+
+// allow returns error if circuit for method is open, otherwise it
+// returns true if call must be used as a probe.
+func (b *breaker) allow(method string) (probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(method)
+	switch {
+	case c.failures < b.threshold:
+		return false, nil
+	case c.probing || time.Now().Before(c.until):
+		return false, errBreakerOpen
+	default:
+		c.probing = true
+		return true, nil
+	}
+}
+
+// done updates circuit for method using result of allowed call.
+func (b *breaker) done(method string, probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(method)
+	if probe {
+		c.probing = false
+	}
+	switch {
+	case b.policy.failure(err):
+		c.failures++
+		if c.failures >= b.threshold {
+			c.until = time.Now().Add(b.cooldown)
+		}
+	case err == context.Canceled:
+	default:
+		c.failures = 0
+	}
+}
@@ -0,0 +1,83 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+func TestBreaker(t *testing.T) {
+	h := &FlakyHandler{Fails: 100, handler: jsonrpc2.HTTPHandler(nil)}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL, jsonrpc2.WithBreaker(jsonrpc2.BreakerPolicy{
+		Threshold: 2,
+		Cooldown:  100 * time.Millisecond,
+	}))
+	defer client.Close()
+
+	call := func() error {
+		var res int
+		return client.Call("Svc.Sum", [2]int{3, 5}, &res)
+	}
+	check := func(wantErr bool, wantRequests int32) {
+		t.Helper()
+		if err := call(); (err != nil) != wantErr {
+			t.Errorf("Call(), err = %v, wantErr = %v", err, wantErr)
+		}
+		if n := atomic.LoadInt32(&h.Requests); n != wantRequests {
+			t.Errorf("requests = %d, want = %d", n, wantRequests)
+		}
+	}
+
+	check(true, 1)
+	check(true, 2)
+	check(true, 2) // Open.
+	if err := client.Call("Svc.SumAll", []int{3, 5}, new(int)); err == nil {
+		t.Errorf("Call() other method, err = nil")
+	}
+	if n := atomic.LoadInt32(&h.Requests); n != 3 {
+		t.Errorf("requests = %d, want = 3", n)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	check(true, 4) // Probe failed.
+	check(true, 4) // Open.
+
+	time.Sleep(150 * time.Millisecond)
+	atomic.StoreInt32(&h.Fails, 0)
+	check(false, 5) // Probe succeeded.
+	check(false, 6)
+}
+
+func TestBreakerRetry(t *testing.T) {
+	h := &FlakyHandler{Fails: 100, handler: jsonrpc2.HTTPHandler(nil)}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL,
+		jsonrpc2.WithBreaker(jsonrpc2.BreakerPolicy{Threshold: 1, Cooldown: time.Minute}),
+		jsonrpc2.WithRetry(jsonrpc2.RetryPolicy{
+			MaxAttempts: 5,
+			Backoff:     jsonrpc2.Backoff{Min: 100 * time.Millisecond},
+			Methods:     []string{"*"},
+		}))
+	defer client.Close()
+
+	client.Call("Svc.Sum", [2]int{3, 5}, new(int)) // Open.
+	requests := atomic.LoadInt32(&h.Requests)
+	start := time.Now()
+	err := jsonrpc2.ServerError(client.Call("Svc.Sum", [2]int{3, 5}, new(int)))
+	if err == nil || err.Code != -32030 {
+		t.Errorf("Call() while open, err = %v", err)
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Errorf("Call() while open took %v", d)
+	}
+	if n := atomic.LoadInt32(&h.Requests); n != requests {
+		t.Errorf("requests = %d, want = %d", n, requests)
+	}
+}
@@ -6,6 +6,8 @@
 package jsonrpc2
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -13,7 +15,9 @@ import (
 	"net"
 	"net/rpc"
 	"reflect"
+	"strconv"
 	"sync"
+	"time"
 )
 
 const seqNotify = math.MaxUint64
@@ -21,41 +25,147 @@ const seqNotify = math.MaxUint64
 type clientCodec struct {
 	dec *json.Decoder // for reading JSON values
 	enc *json.Encoder // for writing JSON values
-	c   io.Closer
+	c   io.ReadWriteCloser
+	tr  *timeoutReader // set only if read timeouts are used
 
 	// temporary work space
 	resp clientResponse
 
+	genID      IDGenerator
+	log        Logger
+	metrics    Metrics
+	tracer     Tracer
+	metaMember string
+	deadlines  bool // send call's deadline in meta
+
 	// JSON-RPC responses include the request id but not the request method.
 	// Package rpc expects both.
 	// We save the request method in pending when sending a request
 	// and then look it up by request ID when filling out the rpc Response.
-	mutex   sync.Mutex        // protects pending
-	pending map[uint64]string // map request id to method name
+	mutex   sync.Mutex                 // protects pending, broken, closed
+	pending map[string]*pendingRequest // map request id key to request
+	broken  bool                       // failed to read response
+	closed  bool
+}
+
+type pendingRequest struct {
+	seq    uint64
+	method string
+	start  time.Time
+	span   Span
 }
 
 // NewClientCodec returns a new rpc.ClientCodec using JSON-RPC 2.0 on conn.
-func NewClientCodec(conn io.ReadWriteCloser) rpc.ClientCodec {
+func NewClientCodec(conn io.ReadWriteCloser, opts ...Option) rpc.ClientCodec {
+	return newClientCodec(conn, newOptions(opts))
+}
+
+func newClientCodec(conn io.ReadWriteCloser, o *options) *clientCodec {
+	var r io.Reader = conn
+	tr := newTimeoutReader(conn, o)
+	if tr != nil {
+		r = tr
+	}
 	return &clientCodec{
-		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
-		c:       conn,
-		pending: make(map[uint64]string),
+		dec:        json.NewDecoder(r),
+		enc:        json.NewEncoder(newTimeoutWriter(conn, o)),
+		c:          conn,
+		tr:         tr,
+		genID:      o.genID,
+		log:        o.logger,
+		metrics:    o.metrics,
+		tracer:     o.tracer,
+		metaMember: o.metaMember,
+		deadlines:  o.propagateDeadline,
+		pending:    make(map[string]*pendingRequest),
 	}
 }
 
+// callArgs is used to pass call's context through rpc.Client to codec.
+type callArgs struct {
+	ctx  context.Context
+	args interface{}
+}
+
+// requestWriter should be implemented by transports which need call's
+// context to send request.
+type requestWriter interface {
+	writeRequest(ctx context.Context, buf []byte) error
+}
+
 type clientRequest struct {
 	Version string      `json:"jsonrpc"`
 	Method  string      `json:"method"`
 	Params  interface{} `json:"params,omitempty"`
-	ID      *uint64     `json:"id,omitempty"`
+	ID      interface{} `json:"id,omitempty"`
+
+	Meta       json.RawMessage `json:"-"` // reserved member, if any
+	metaMember string          // name of reserved member
+}
+
+// MarshalJSON adds reserved member Meta (if it's not nil) after other
+// request members.
+func (r *clientRequest) MarshalJSON() ([]byte, error) {
+	type request clientRequest
+	if r.Meta == nil {
+		return json.Marshal((*request)(r))
+	}
+	members := []struct {
+		name  string
+		value interface{}
+	}{
+		{"jsonrpc", r.Version},
+		{"method", r.Method},
+		{"params", r.Params},
+		{"id", r.ID},
+		{r.metaMember, r.Meta},
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, m := range members {
+		if m.value == nil {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
 }
 
 func (c *clientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
 	// If return error: it will be returned as is for this call.
+	ctx := context.Background()
+	if arg, ok := param.(*callArgs); ok {
+		ctx, param = arg.ctx, arg.args
+	}
 	// Allow param to be only Array, Slice, Map or Struct.
 	// When param is nil or uninitialized Map or Slice - omit "params".
-	if param != nil {
+	// Raw param is sent as is, so it must contain Array or Object.
+	switch raw := param.(type) {
+	case nil:
+	case json.RawMessage:
+		if raw == nil {
+			param = nil
+		} else if err := checkRawParams(raw); err != nil {
+			return err
+		}
+	case *json.RawMessage:
+		if raw == nil || *raw == nil {
+			param = nil
+		} else if err := checkRawParams(*raw); err != nil {
+			return err
+		}
+	default:
 		switch k := reflect.TypeOf(param).Kind(); k {
 		case reflect.Map:
 			if reflect.TypeOf(param).Key().Kind() == reflect.String {
@@ -90,26 +200,126 @@ func (c *clientCodec) WriteRequest(r *rpc.Request, param interface{}) error {
 	}
 
 	var req clientRequest
+	var key string
+	start := time.Now()
 	if r.Seq != seqNotify {
+		var err error
+		req.ID, key, err = c.newID(r.Seq)
+		if err != nil {
+			return err
+		}
+	}
+	ctx, span := startSpan(ctx, c.tracer, ClientSide, r.ServiceMethod)
+	if req.ID != nil {
 		c.mutex.Lock()
-		c.pending[r.Seq] = r.ServiceMethod
+		c.pending[key] = &pendingRequest{seq: r.Seq, method: r.ServiceMethod, start: start, span: span}
+		c.tr.setBusy(len(c.pending))
 		c.mutex.Unlock()
-		req.ID = &r.Seq
 	}
 	req.Version = "2.0"
 	req.Method = r.ServiceMethod
 	req.Params = param
-	if err := c.enc.Encode(&req); err != nil {
+	if c.metrics != nil {
+		c.metrics.CallStarted(ClientSide, r.ServiceMethod)
+	}
+	err := c.encode(ctx, &req)
+	if err != nil && req.ID != nil {
+		c.mutex.Lock()
+		delete(c.pending, key)
+		c.tr.setBusy(len(c.pending))
+		c.mutex.Unlock()
+	}
+	if err != nil || req.ID == nil {
+		e, _ := err.(*Error)
+		endSpan(span, e)
+	}
+	if c.metrics != nil && (err != nil || req.ID == nil) {
+		code := 0
+		if err != nil {
+			code = errInternal.Code
+		}
+		c.metrics.CallFinished(ClientSide, r.ServiceMethod, code, time.Since(start))
+	}
+	return err
+}
+
+// checkRawParams returns error if raw doesn't contain Array or Object.
+func checkRawParams(raw json.RawMessage) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '[' && raw[0] != '{' || !json.Valid(raw) {
+		return NewError(errInternal.Code, "unsupported param type: invalid json.RawMessage")
+	}
+	return nil
+}
+
+// newID returns ID for request with given sequence number and it's key.
+func (c *clientCodec) newID(seq uint64) (id interface{}, key string, err error) {
+	if c.genID == nil {
+		return seq, strconv.FormatUint(seq, 10), nil
+	}
+	id = c.genID(seq)
+	buf, err := json.Marshal(id)
+	if err != nil {
+		return nil, "", NewError(errInternal.Code, err.Error())
+	}
+	key, ok := idKey(buf)
+	if !ok {
+		return nil, "", NewError(errInternal.Code, "unsupported id type: "+string(buf))
+	}
+	return json.RawMessage(buf), key, nil
+}
+
+func (c *clientCodec) encode(ctx context.Context, req *clientRequest) error {
+	req.Meta, req.metaMember = c.requestMeta(ctx), c.metaMember
+	w, ok := c.c.(requestWriter)
+	if !ok {
+		if err := c.enc.Encode(req); err != nil {
+			return NewError(errInternal.Code, err.Error())
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req); err != nil {
+		return NewError(errInternal.Code, err.Error())
+	}
+	if err := w.writeRequest(ctx, buf.Bytes()); err != nil {
 		return NewError(errInternal.Code, err.Error())
 	}
 	return nil
 }
 
+// requestMeta returns value for reserved request member configured by
+// WithMetaMember or nil if it shouldn't be sent.
+func (c *clientCodec) requestMeta(ctx context.Context) json.RawMessage {
+	if c.metaMember == "" {
+		return nil
+	}
+	m := make(map[string]string)
+	for k, v := range outgoingMetadata(ctx) {
+		if !isReservedMeta(k) {
+			m[k] = v
+		}
+	}
+	if sc, ok := SpanContextFromContext(ctx); ok && sc.IsValid() {
+		m[traceparentMeta] = sc.Traceparent()
+	}
+	if timeout, ok := timeoutFromContext(ctx); ok && c.deadlines {
+		m[timeoutMeta] = timeout
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	meta, _ := json.Marshal(m)
+	return meta
+}
+
 type clientResponse struct {
 	Version string           `json:"jsonrpc"`
-	ID      *uint64          `json:"id"`
+	ID      *json.RawMessage `json:"id"`
 	Result  *json.RawMessage `json:"result,omitempty"`
 	Error   *Error           `json:"error,omitempty"`
+	Method  string           `json:"method,omitempty"` // set only for notification
 }
 
 func (r *clientResponse) reset() {
@@ -117,12 +327,13 @@ func (r *clientResponse) reset() {
 	r.ID = nil
 	r.Result = nil
 	r.Error = nil
+	r.Method = ""
 }
 
 func (r *clientResponse) UnmarshalJSON(raw []byte) error {
 	r.reset()
-	type resp *clientResponse
-	if err := json.Unmarshal(raw, resp(r)); err != nil {
+	type resp clientResponse
+	if err := json.Unmarshal(raw, (*resp)(r)); err != nil {
 		return errors.New("bad response: " + string(raw))
 	}
 
@@ -134,6 +345,12 @@ func (r *clientResponse) UnmarshalJSON(raw []byte) error {
 	_, okID := o["id"]
 	_, okRes := o["result"]
 	_, okErr := o["error"]
+	if _, okMethod := o["method"]; okMethod && !okID && !okRes && !okErr {
+		if r.Version != "2.0" || r.Method == "" {
+			return errors.New("bad response: " + string(raw))
+		}
+		return nil
+	}
 	if !okVer || !okID || !(okRes || okErr) || (okRes && okErr) || len(o) > 3 {
 		return errors.New("bad response: " + string(raw))
 	}
@@ -161,33 +378,82 @@ func (r *clientResponse) UnmarshalJSON(raw []byte) error {
 	if o["id"] == nil && !okErr {
 		return errors.New("bad response: " + string(raw))
 	}
+	if r.ID != nil {
+		if _, ok := idKey(*r.ID); !ok {
+			return errors.New("bad response: " + string(raw))
+		}
+	}
 
 	return nil
 }
 
-func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+func (c *clientCodec) ReadResponseHeader(r *rpc.Response) (err error) {
 	// If return err:
 	// - io.EOF will became ErrShutdown or io.ErrUnexpectedEOF
 	// - it will be returned as is for all pending calls
 	// - client will be shutdown
 	// So, return io.EOF as is, return *Error for all other errors.
+	defer func() {
+		if err != nil {
+			c.mutex.Lock()
+			c.broken = true
+			c.mutex.Unlock()
+			c.failPending()
+		}
+	}()
+	c.tr.wait()
 	if err := c.dec.Decode(&c.resp); err != nil {
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			return err
 		}
+		if isTimeout(err) {
+			c.log.Info("connection timeout", "err", err)
+			_ = c.c.Close()
+			return io.ErrUnexpectedEOF
+		}
+		c.log.Warn("bad response", "err", err)
 		return NewError(errInternal.Code, err.Error())
 	}
+	if c.resp.Method != "" {
+		// Notification sent by server (e.g. about shutdown) is ignored.
+		c.log.Debug("notification", "method", c.resp.Method)
+		r.ServiceMethod = ""
+		r.Seq = seqNotify
+		r.Error = ""
+		return nil
+	}
 	if c.resp.ID == nil {
 		return c.resp.Error
 	}
 
+	// Response with unknown ID will be ignored by rpc.Client.
+	r.ServiceMethod = ""
+	r.Seq = seqNotify
+	key, _ := idKey(*c.resp.ID)
 	c.mutex.Lock()
-	r.ServiceMethod = c.pending[*c.resp.ID]
-	delete(c.pending, *c.resp.ID)
+	req := c.pending[key]
+	if req != nil {
+		r.ServiceMethod = req.method
+		r.Seq = req.seq
+		delete(c.pending, key)
+	}
+	c.tr.setBusy(len(c.pending))
 	c.mutex.Unlock()
+	if req != nil && c.metrics != nil {
+		code := 0
+		if c.resp.Error != nil {
+			code = c.resp.Error.Code
+		}
+		c.metrics.CallFinished(ClientSide, req.method, code, time.Since(req.start))
+	}
+	if req != nil {
+		endSpan(req.span, c.resp.Error)
+	}
+	if r.Seq == seqNotify {
+		c.log.Warn("response with unknown id", "id", string(*c.resp.ID))
+	}
 
 	r.Error = ""
-	r.Seq = *c.resp.ID
 	if c.resp.Error != nil {
 		r.Error = c.resp.Error.Error()
 	}
@@ -203,6 +469,10 @@ func (c *clientCodec) ReadResponseBody(x interface{}) error {
 	if x == nil {
 		return nil
 	}
+	if raw, ok := x.(*json.RawMessage); ok {
+		*raw = append((*raw)[:0], *c.resp.Result...)
+		return nil
+	}
 	if err := json.Unmarshal(*c.resp.Result, x); err != nil {
 		e := NewError(errInternal.Code, err.Error())
 		e.Data = NewError(errInternal.Code, "some other Call failed to unmarshal Reply")
@@ -212,9 +482,45 @@ func (c *clientCodec) ReadResponseBody(x interface{}) error {
 }
 
 func (c *clientCodec) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	c.mutex.Unlock()
+	c.failPending()
 	return c.c.Close()
 }
 
+// failPending reports all pending calls as failed, it must be called
+// only after codec was broken or closed.
+func (c *clientCodec) failPending() {
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = make(map[string]*pendingRequest)
+	c.mutex.Unlock()
+	for _, req := range pending {
+		if c.metrics != nil {
+			c.metrics.CallFinished(ClientSide, req.method, errInternal.Code, time.Since(req.start))
+		}
+		endSpan(req.span, errNoResponse)
+	}
+}
+
+// pendingCount implements pendingCounter.
+func (c *clientCodec) pendingCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.pending)
+}
+
+// connState implements connStater.
+func (c *clientCodec) connState() ConnState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.broken || c.closed {
+		return StateClosed
+	}
+	return StateConnected
+}
+
 // Client represents a JSON RPC 2.0 Client.
 // There may be multiple outstanding Calls associated
 // with a single Client, and a Client may be used by
@@ -223,7 +529,72 @@ func (c *clientCodec) Close() error {
 // It also provides all methods of net/rpc Client.
 type Client struct {
 	*rpc.Client
-	codec rpc.ClientCodec
+	codec   rpc.ClientCodec
+	retry   *RetryPolicy
+	breaker *breaker
+}
+
+// Call invokes the named function, waits for it to complete, and returns
+// its error status. Failed call will be retried according to WithRetry.
+func (c Client) Call(serviceMethod string, args, reply interface{}) error {
+	return c.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext is like Call but it stops waiting for the call when ctx is
+// done and returns ctx.Err(). In this case reply won't be modified even
+// if response will be received later.
+func (c Client) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if c.retry == nil {
+		return c.callContext(ctx, serviceMethod, args, reply)
+	}
+	return c.retry.do(ctx, serviceMethod, func() error {
+		return c.callContext(ctx, serviceMethod, args, reply)
+	}, func() bool {
+		return c.State() == StateClosed
+	})
+}
+
+func (c Client) callContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if c.breaker == nil {
+		return c.callOnce(ctx, serviceMethod, args, reply)
+	}
+	probe, err := c.breaker.allow(serviceMethod)
+	if err != nil {
+		return err
+	}
+	err = c.callOnce(ctx, serviceMethod, args, reply)
+	c.breaker.done(serviceMethod, probe, err)
+	return err
+}
+
+func (c Client) callOnce(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if ctx == context.Background() {
+		return c.Client.Call(serviceMethod, args, reply)
+	}
+	if ctx.Done() == nil {
+		return c.Client.Call(serviceMethod, &callArgs{ctx: ctx, args: args}, reply)
+	}
+
+	// Late response must not modify reply, so unmarshal it only after
+	// the call is done in time.
+	var raw json.RawMessage
+	var rawReply interface{}
+	if reply != nil {
+		rawReply = &raw
+	}
+	call := c.Client.Go(serviceMethod, &callArgs{ctx: ctx, args: args}, rawReply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if call.Error != nil || reply == nil {
+		return call.Error
+	}
+	if err := json.Unmarshal(raw, reply); err != nil {
+		return NewError(errInternal.Code, err.Error())
+	}
+	return nil
 }
 
 // Notify try to invoke the named function. It return error only in case
@@ -236,23 +607,56 @@ func (c Client) Notify(serviceMethod string, args interface{}) error {
 	return c.codec.WriteRequest(req, args)
 }
 
+// State returns current state of client's connection.
+//
+// Client which uses custom rpc.ClientCodec is always reported as
+// StateConnected.
+func (c Client) State() ConnState {
+	if s, ok := c.codec.(connStater); ok {
+		return s.connState()
+	}
+	return StateConnected
+}
+
+// Health returns nil if client is connected, rpc.ErrShutdown if client
+// is closed or *Error otherwise.
+func (c Client) Health() error {
+	switch c.State() {
+	case StateConnected:
+		return nil
+	case StateClosed:
+		return rpc.ErrShutdown
+	default:
+		return errNotConnected
+	}
+}
+
 // NewClient returns a new Client to handle requests to the
 // set of services at the other end of the connection.
-func NewClient(conn io.ReadWriteCloser) *Client {
-	return NewClientWithCodec(NewClientCodec(conn))
+func NewClient(conn io.ReadWriteCloser, opts ...Option) *Client {
+	o := newOptions(opts)
+	return newClient(newClientCodec(conn, o), o)
 }
 
 // NewClientWithCodec returns a new Client using the given rpc.ClientCodec.
-func NewClientWithCodec(codec rpc.ClientCodec) *Client {
-	client := rpc.NewClientWithCodec(codec)
-	return &Client{client, codec}
+func NewClientWithCodec(codec rpc.ClientCodec, opts ...Option) *Client {
+	return newClient(codec, newOptions(opts))
+}
+
+func newClient(codec rpc.ClientCodec, o *options) *Client {
+	return &Client{
+		Client:  rpc.NewClientWithCodec(codec),
+		codec:   codec,
+		retry:   o.retry,
+		breaker: newBreaker(o.breaker),
+	}
 }
 
 // Dial connects to a JSON-RPC 2.0 server at the specified network address.
-func Dial(network, address string) (*Client, error) {
+func Dial(network, address string, opts ...Option) (*Client, error) {
 	conn, err := net.Dial(network, address)
 	if err != nil {
 		return nil, err
 	}
-	return NewClient(conn), err
+	return NewClient(conn, opts...), err
 }
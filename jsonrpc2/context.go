@@ -2,6 +2,21 @@ package jsonrpc2
 
 import "context"
 
+type contextKey int
+
+const (
+	httpRequestContextKey contextKey = iota
+	notifierContextKey
+	notificationsContextKey
+	spanContextKey
+	principalContextKey
+	connInfoContextKey
+	outgoingMetadataContextKey
+	incomingMetadataContextKey
+	responseMetadataContextKey
+	responseHeaderContextKey
+)
+
 // WithContext is an interface which should be implemented by RPC method
 // parameters type if you need access to request context in RPC method.
 //
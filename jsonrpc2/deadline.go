@@ -0,0 +1,90 @@
+package jsonrpc2
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	timeoutHeader = "X-Request-Timeout"
+	timeoutMeta   = "timeout"
+)
+
+// timeoutUnits maps grpc-timeout units to their durations.
+var timeoutUnits = map[byte]time.Duration{ //nolint:gochecknoglobals
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// maxTimeoutValue is max value of timeout with up to 8 digits.
+const maxTimeoutValue = 99999999
+
+// formatTimeout returns d in grpc-timeout format with millisecond
+// precision, e.g. "1500m". Coarser unit ("S", "M" or "H") is used if
+// amount of milliseconds doesn't fit into 8 digits.
+func formatTimeout(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	for _, unit := range []byte("mSM") {
+		if n := ceilDiv(d, timeoutUnits[unit]); n <= maxTimeoutValue {
+			return strconv.FormatInt(int64(n), 10) + string(unit)
+		}
+	}
+	return strconv.FormatInt(int64(ceilDiv(d, time.Hour)), 10) + "H"
+}
+
+// ceilDiv returns d divided by unit, rounded up.
+func ceilDiv(d, unit time.Duration) time.Duration {
+	n := d / unit
+	if d%unit != 0 {
+		n++
+	}
+	return n
+}
+
+// parseTimeout parses timeout in grpc-timeout format: up to 8 digits
+// followed by unit (one of "HMSmun").
+func parseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, errors.New("invalid timeout: " + s)
+	}
+	unit, ok := timeoutUnits[s[len(s)-1]]
+	if !ok {
+		return 0, errors.New("invalid timeout: " + s)
+	}
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid timeout: " + s)
+	}
+	if n > uint64(math.MaxInt64/unit) {
+		return math.MaxInt64, nil
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// timeoutFromContext returns timeout to send with call made using ctx.
+func timeoutFromContext(ctx context.Context) (string, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return "", false
+	}
+	return formatTimeout(time.Until(deadline)), true
+}
+
+// withTimeout returns ctx with deadline set using received timeout, if
+// it's valid.
+func withTimeout(ctx context.Context, timeout string) (context.Context, context.CancelFunc) {
+	d, err := parseTimeout(timeout)
+	if err != nil {
+		return ctx, nil
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,138 @@
+// nolint:errcheck
+package jsonrpc2
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"testing"
+	"time"
+)
+
+// DeadlineSvc is an RPC service for testing.
+type DeadlineSvc struct{}
+
+type DeadlineArg struct{ Ctx }
+
+// Remaining returns time until request context deadline or -1 if there
+// is no deadline.
+func (DeadlineSvc) Remaining(arg DeadlineArg, res *time.Duration) error {
+	*res = -1
+	if deadline, ok := arg.Context().Deadline(); ok {
+		*res = time.Until(deadline)
+	}
+	return nil
+}
+
+func TestTimeoutFormat(t *testing.T) {
+	for _, c := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{-time.Second, "0m"},
+		{0, "0m"},
+		{time.Microsecond, "1m"},
+		{1500 * time.Millisecond, "1500m"},
+		{99999999 * time.Millisecond, "99999999m"},
+		{99999999*time.Millisecond + 1, "100000S"},
+		{72 * time.Hour, "259200S"},
+		{3000 * time.Hour, "10800000S"},
+		{2000*24*time.Hour + time.Second, "2880001M"},
+		{math.MaxInt64, "2562048H"},
+	} {
+		got := formatTimeout(c.d)
+		if got != c.want {
+			t.Errorf("formatTimeout(%v) = %q, want %q", c.d, got, c.want)
+		}
+		if d, err := parseTimeout(got); err != nil || d < c.d {
+			t.Errorf("parseTimeout(%q) = %v, %v, want >= %v", got, d, err, c.d)
+		}
+	}
+	for _, c := range []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"1500m", 1500 * time.Millisecond, false},
+		{"2S", 2 * time.Second, false},
+		{"1H", time.Hour, false},
+		{"10n", 10, false},
+		{"99999999u", 99999999 * time.Microsecond, false},
+		{"", 0, true},
+		{"m", 0, true},
+		{"10", 0, true},
+		{"10s", 0, true},
+		{"-1m", 0, true},
+		{"123456789m", 0, true},
+		{"99999999H", math.MaxInt64, false},
+	} {
+		got, err := parseTimeout(c.s)
+		if got != c.want || (err != nil) != c.wantErr {
+			t.Errorf("parseTimeout(%q) = %v, %v", c.s, got, err)
+		}
+	}
+}
+
+func TestDeadlineStream(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(DeadlineSvc{})
+	dial := func(server, client []Option) *Client {
+		cli, conn := net.Pipe()
+		go srv.ServeCodec(NewServerCodec(conn, srv, server...))
+		return NewClient(cli, client...)
+	}
+	opts := []Option{WithMetaMember("meta"), WithDeadlinePropagation()}
+
+	cases := []struct {
+		name           string
+		server, client []Option
+		propagated     bool
+	}{
+		{"enabled", opts, opts, true},
+		{"client disabled", opts, opts[:1], false},
+		{"server disabled", opts[:1], opts, false},
+	}
+	for _, c := range cases {
+		client := dial(c.server, c.client)
+		var res time.Duration
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := client.CallContext(ctx, "DeadlineSvc.Remaining", nil, &res)
+		cancel()
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if propagated := res > 0 && res <= time.Second; propagated != c.propagated {
+			t.Errorf("%s: remaining = %v", c.name, res)
+		}
+		if err := client.Call("DeadlineSvc.Remaining", nil, &res); err != nil || res != -1 {
+			t.Errorf("%s: without deadline: remaining = %v, %v", c.name, res, err)
+		}
+		client.Close()
+	}
+}
+
+func TestDeadlineHTTP(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(DeadlineSvc{})
+	ts := httptest.NewServer(HTTPHandler(srv, WithDeadlinePropagation()))
+	defer ts.Close()
+
+	client := NewHTTPClient(ts.URL, WithDeadlinePropagation())
+	defer client.Close()
+	var res time.Duration
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.CallContext(ctx, "DeadlineSvc.Remaining", nil, &res); err != nil || res <= 0 || res > time.Second {
+		t.Errorf("remaining = %v, %v", res, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 72*time.Hour)
+	defer cancel()
+	if err := client.CallContext(ctx, "DeadlineSvc.Remaining", nil, &res); err != nil || res <= 71*time.Hour || res > 72*time.Hour {
+		t.Errorf("multi-day deadline: remaining = %v, %v", res, err)
+	}
+	if err := client.Call("DeadlineSvc.Remaining", nil, &res); err != nil || res != -1 {
+		t.Errorf("without deadline: remaining = %v, %v", res, err)
+	}
+}
@@ -34,6 +34,13 @@ To call such a method you'll have to use client.Call() with []interface{}
 in args.
 
 
+Raw params and results
+
+Client sends json.RawMessage (or *json.RawMessage) args as is, so they
+must contain valid JSON Array or Object. Use *json.RawMessage as reply to
+receive result without unmarshalling it, which is useful for proxies.
+
+
 Using context to provide transport-level details with parameters
 
 If you want to have access to transport-level details (or any other
@@ -44,6 +51,153 @@ struct then you can just embed Ctx into your struct as shown in example.)
 This way you can get access to client IP address or details of client HTTP
 request etc. in RPC method.
 
+RPC method can set headers (e.g. cookies or caching) and status of HTTP
+response using ResponseMetadataFromContext. Client can receive headers
+of HTTP response to call using ContextWithResponseHeader.
+
+
+Streaming responses over HTTP
+
+RPC method can send notifications to client while processing request
+using Notifier returned by NotifierFromContext, if client has requested
+streaming response. Over HTTP this is done by sending request with
+"Accept: text/event-stream" header: HTTPHandler will then send each
+notification and final response as a separate Server-Sent Event.
+
+To receive these notifications use client.GoStream() instead of
+client.Go().
+
+
+Reconnecting client
+
+Client returned by Dial will fail all calls with rpc.ErrShutdown after
+connection is lost. Use DialReconnecting to get Client which will
+transparently redial with exponential backoff. Use Client.State and
+Client.Health to check connection's state.
+
+
+Pool of clients
+
+Use NewPool to get client which holds connections to one or more
+endpoints (provided by Resolver) and balance calls between them.
+
+
+Retrying calls
+
+Use WithRetry option to make Client or Pool retry failed calls to
+idempotent methods. Use Client.CallContext to limit time spent on call
+including all retries.
+
+Use WithBreaker option to make Client fail calls immediately while
+endpoint looks broken, and WithHedging option to make Pool send
+duplicate call to another endpoint when call takes too long.
+
+
+Asynchronous calls
+
+Client.Async and Pool.Async return Future which can be awaited (with
+result's error converted to *Error) or used to register OnDone callback.
+Use AwaitAll to wait for several calls made in parallel.
+
+Client doesn't support sending batch requests: each Future is a
+separate request, so AwaitAll doesn't provide batch semantics (single
+round-trip) even for HTTP transport.
+
+
+Typed helpers
+
+Generic functions Call, Notify and Await provide typed params and
+result for client, and Handle registers typed function as RPC method
+on server (it also provides request context to the function).
+
+
+Logging
+
+Use WithLogger option to provide logger (like *slog.Logger) to client,
+server codec or HTTP handler. It'll be used to log protocol errors,
+transport failures and dropped responses. Use WithAccessLog option to
+also log each call processed by server.
+
+
+Metrics
+
+Use WithMetrics option to collect metrics of calls made by client or
+processed by server codec or HTTP handler. PrometheusMetrics collects
+them and exposes in Prometheus text format as http.Handler.
+
+
+Tracing
+
+Client sends W3C trace context from call's context (see
+ContextWithSpanContext) and server provides it in request context (see
+SpanContextFromContext). HTTP transport uses traceparent header, other
+transports need WithMetaMember option on both sides to send it in
+reserved request member. Use WithTracer option to start span for each
+call made by client or processed by server.
+
+Same reserved request member is used to send metadata (like auth token
+or tenant ID) from call's context (see ContextWithMetadata), server
+provides it in request context (see MetadataFromContext). Received
+metadata isn't forwarded by calls made with request context.
+
+
+Limits
+
+Server codec and HTTP handler accept requests of any size by default.
+Use WithMaxMessageSize, WithMaxDepth and WithMaxBatchLen options to
+reject too large requests and WithMaxConcurrentRequests option to limit
+amount of concurrent requests processed per connection.
+
+Requests from batch are processed concurrently and replies are returned
+in same order as requests. Use WithBatchParallelism or
+WithSequentialBatch options to limit concurrency and WithBatchTimeout
+option to limit time used to process batch.
+
+
+Authentication
+
+Use WithAuthenticator option to authenticate clients by HTTP handler
+(using HTTP headers or TLS client certificate) or by server codec
+(using TLS client certificate or first call of AuthenticateMethod with
+credentials in params). Principal returned by Authenticator is available
+in request context using PrincipalFromContext.
+
+Use WithPolicy option to allow calling methods only by some clients.
+Denied calls (including calls in batch) are rejected before processing
+with same error as returned for unknown method.
+
+
+Rate limits
+
+Use WithRateLimit option to limit amount of calls per second per
+connection, client's IP address, authenticated client and/or method.
+Limited calls are rejected before processing with error code -32029
+(configurable) and amount of seconds to wait in "retry_after" member of
+error's data. HTTP handler also replies with HTTP status 429 and
+Retry-After header unless limited call was a part of batch request.
+
+
+Graceful shutdown
+
+ServeConn serves connection until client hangs up. Use Server to accept
+and serve connections which may be shut down: Shutdown closes listeners,
+rejects new calls with error code -32001, waits until calls in progress
+will be completed and closes connections, while Close does all of this
+without waiting. Use Conns and InFlight to inspect served connections.
+
+Use WithIdleTimeout, WithReadTimeout and WithWriteTimeout options to
+make client and server codecs close connections (which support
+deadlines, like net.Conn) with idle, slow or stalled peers.
+
+Use WithCallTimeout option to limit time used by server to process
+calls. Timed out calls get error with code -32000 (configurable) without
+waiting until method returns, it's late result will be dropped.
+
+Use WithDeadlinePropagation option on both client and server to make
+request context on server have same deadline as call's context on
+client. It's sent in X-Request-Timeout header by HTTP client and in
+reserved member configured by WithMetaMember by other clients.
+
 
 Decoding errors on client
 
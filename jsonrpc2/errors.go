@@ -17,6 +17,9 @@ var (
 	errInternal    = NewError(-32603, "internal error")
 	errServer      = NewError(-32000, "server error")
 	errServerError = NewError(-32001, "jsonrpc2.Error: json.Marshal failed")
+
+	errNotConnected = NewError(-32603, "not connected")
+	errNoResponse   = NewError(-32603, "no response")
 )
 
 // Error represent JSON-RPC 2.0 "Error object".
@@ -49,17 +52,26 @@ func newError(message string) *Error {
 // User should check for rpc.ErrShutdown and io.ErrUnexpectedEOF before
 // calling ServerError.
 func ServerError(rpcerr error) *Error {
+	e, err := serverError(rpcerr)
+	if err != nil {
+		panic(fmt.Sprintf("not a jsonrpc2 error: %s (%#q)", err, rpcerr))
+	}
+	return e
+}
+
+// serverError is like ServerError but returns error instead of panic.
+func serverError(rpcerr error) (*Error, error) {
 	if rpcerr == nil {
-		return nil
+		return nil, nil
 	}
 	if err, ok := rpcerr.(*Error); ok {
 		if err.Code == errInternal.Code && err.Data != nil {
 			if err2, ok := err.Data.(*Error); ok {
 				// Use alternate error when ReadResponseBody fail on other call.
-				return err2
+				return err2, nil
 			}
 		}
-		return err
+		return err, nil
 	}
 	keepData := true
 	errmsg := rpcerr.Error()
@@ -71,13 +83,13 @@ func ServerError(rpcerr error) *Error {
 	e := &Error{}
 	err := json.Unmarshal([]byte(errmsg), e)
 	if err != nil {
-		panic(fmt.Sprintf("not a jsonrpc2 error: %s (%#q)", err, rpcerr))
+		return nil, err
 	}
 	if e.Code == errInternal.Code && e.Data != nil && !keepData {
 		// ReadResponseBody fail on this call.
 		e.Data = nil
 	}
-	return e
+	return e, nil
 }
 
 // Error returns JSON representation of Error.
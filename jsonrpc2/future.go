@@ -0,0 +1,127 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/rpc"
+	"sync"
+)
+
+// Future represents asynchronous call started by Client.Async or
+// Pool.Async.
+type Future struct {
+	done chan struct{}
+	raw  json.RawMessage
+	err  error
+
+	mu        sync.Mutex // protects callbacks
+	callbacks []func(*Future)
+}
+
+// newFuture starts call in background and returns Future for its result.
+func newFuture(call func(reply interface{}) error) *Future {
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		f.err = typedError(call(&f.raw))
+		f.mu.Lock()
+		close(f.done)
+		callbacks := f.callbacks
+		f.callbacks = nil
+		f.mu.Unlock()
+		for _, fn := range callbacks {
+			fn(f)
+		}
+	}()
+	return f
+}
+
+// typedError converts error returned by Client.Call to *Error, except
+// for rpc.ErrShutdown, io.ErrUnexpectedEOF and context errors.
+func typedError(err error) error {
+	switch err {
+	case nil, rpc.ErrShutdown, io.ErrUnexpectedEOF, context.Canceled, context.DeadlineExceeded:
+		return err
+	}
+	if e, errNotRPC := serverError(err); errNotRPC == nil {
+		return e
+	}
+	return err
+}
+
+// Async invokes the named function asynchronously and returns Future for
+// its result. Call will be canceled when ctx is done.
+func (c Client) Async(ctx context.Context, serviceMethod string, args interface{}) *Future {
+	return newFuture(func(reply interface{}) error {
+		return c.CallContext(ctx, serviceMethod, args, reply)
+	})
+}
+
+// Async invokes the named function asynchronously on one of endpoints
+// and returns Future for its result. Call will be canceled when ctx is
+// done.
+func (p *Pool) Async(ctx context.Context, serviceMethod string, args interface{}) *Future {
+	return newFuture(func(reply interface{}) error {
+		return p.CallContext(ctx, serviceMethod, args, reply)
+	})
+}
+
+// Done returns a channel which is closed when call completes.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await waits until call completes or ctx is done and returns call's
+// error or unmarshal call's result into reply (if it's not nil).
+//
+// Returned error is either *Error, rpc.ErrShutdown, io.ErrUnexpectedEOF
+// or context error. Await may be called more than once.
+func (f *Future) Await(ctx context.Context, reply interface{}) error {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if f.err != nil || reply == nil {
+		return f.err
+	}
+	if err := json.Unmarshal(f.raw, reply); err != nil {
+		return NewError(errInternal.Code, err.Error())
+	}
+	return nil
+}
+
+// OnDone registers fn to be called when call completes. If call is
+// already completed then fn will be called immediately.
+//
+// Callbacks are called in order of registration by single goroutine,
+// so they shouldn't block.
+func (f *Future) OnDone(fn func(*Future)) {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		fn(f)
+	default:
+		f.callbacks = append(f.callbacks, fn)
+		f.mu.Unlock()
+	}
+}
+
+// AwaitAll waits until all calls complete or ctx is done. It returns
+// first error returned by any call (in order of futures) or context
+// error. Use Await to get result of each call.
+//
+// Calls are sent as separate requests, not as a batch request.
+func AwaitAll(ctx context.Context, futures ...*Future) error {
+	var err error
+	for _, f := range futures {
+		if errAwait := f.Await(ctx, nil); errAwait != nil && err == nil {
+			err = errAwait
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+func TestFuture(t *testing.T) {
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(nil))
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL)
+	defer client.Close()
+	ctx := context.Background()
+
+	f1 := client.Async(ctx, "Svc.Sum", [2]int{3, 5})
+	f2 := client.Async(ctx, "Svc.Sum", [2]int{1, 2})
+	f3 := client.Async(ctx, "Svc.Missing", nil)
+	if err := jsonrpc2.AwaitAll(ctx, f1, f2); err != nil {
+		t.Errorf("AwaitAll(), err = %v", err)
+	}
+	var res1, res2 int
+	if err := f1.Await(ctx, &res1); err != nil || res1 != 8 {
+		t.Errorf("Await() = %v, %v, want = 8, nil", res1, err)
+	}
+	if err := f2.Await(ctx, &res2); err != nil || res2 != 3 {
+		t.Errorf("Await() = %v, %v, want = 3, nil", res2, err)
+	}
+
+	err := jsonrpc2.AwaitAll(ctx, f1, f3, f2)
+	if e, ok := err.(*jsonrpc2.Error); !ok || e.Code != -32601 {
+		t.Errorf("AwaitAll(), err = %#v, want *Error with code -32601", err)
+	}
+
+	called := make(chan int, 2)
+	f1.OnDone(func(f *jsonrpc2.Future) {
+		var res int
+		f.Await(ctx, &res)
+		called <- res
+	})
+	if res := <-called; res != 8 {
+		t.Errorf("OnDone() res = %d, want = 8", res)
+	}
+}
+
+func TestFutureCancel(t *testing.T) {
+	s := newPoolServer(t, 1)
+	defer s.Close()
+	defer close(s.svc.block)
+	client, err := jsonrpc2.Dial("tcp", s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := client.Async(ctx, "PoolSvc.Block", struct{}{})
+	done := make(chan error, 1)
+	f.OnDone(func(f *jsonrpc2.Future) { done <- f.Await(context.Background(), nil) })
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	if err := f.Await(waitCtx, nil); err != context.DeadlineExceeded {
+		t.Errorf("Await(), err = %v, want = %v", err, context.DeadlineExceeded)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("OnDone() err = %v, want = %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("OnDone() not called after cancel")
+	}
+}
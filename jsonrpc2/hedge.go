@@ -0,0 +1,144 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgePercentile = 0.95
+	defaultHedgeDelay      = 100 * time.Millisecond
+	latencyWindow          = 128 // Amount of recent latencies used by Pool.
+	latencyMinSamples      = 16  // Use HedgePolicy.Delay until collected.
+)
+
+// HedgePolicy describes when Pool should send duplicate call.
+//
+// If call doesn't complete in time defined by Percentile of recent
+// successful calls latency then Pool sends same call using another
+// connection and returns whichever reply comes first.
+//
+// Only calls made using Call and CallContext are hedged.
+type HedgePolicy struct {
+	// Percentile of recent calls latency (0.95 by default).
+	Percentile float64
+	// Delay is used instead of Percentile until Pool collects enough
+	// latencies (100ms by default).
+	Delay time.Duration
+	// Methods lists idempotent methods which are safe to hedge.
+	// Each entry is a pattern in path.Match syntax, e.g. "Svc.Get*" or
+	// "*" to hedge all methods.
+	Methods []string
+}
+
+// latencies keeps ring buffer of recent latencies.
+type latencies struct {
+	mu   sync.Mutex
+	buf  []time.Duration
+	next int
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) < latencyWindow {
+		l.buf = append(l.buf, d)
+		return
+	}
+	l.buf[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+}
+
+// percentile returns p-th percentile (0..1) of recent latencies or false
+// if there are too few of them.
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	buf := append([]time.Duration(nil), l.buf...)
+	l.mu.Unlock()
+	if len(buf) < latencyMinSamples {
+		return 0, false
+	}
+	sort.Slice(buf, func(i, j int) bool { return buf[i] < buf[j] })
+	i := int(p * float64(len(buf)))
+	if i >= len(buf) {
+		i = len(buf) - 1
+	}
+	return buf[i], true
+}
+
+func (p *Pool) hedgeDelay() time.Duration {
+	percentile := p.o.hedge.Percentile
+	if percentile <= 0 || percentile > 1 {
+		percentile = defaultHedgePercentile
+	}
+	if d, ok := p.latency.percentile(percentile); ok {
+		return d
+	}
+	if p.o.hedge.Delay > 0 {
+		return p.o.hedge.Delay
+	}
+	return defaultHedgeDelay
+}
+
+type hedgeResult struct {
+	raw json.RawMessage
+	err error
+}
+
+// hedgedCall sends call using one connection and, if it won't complete
+// in time, sends same call using another connection.
+func (p *Pool) hedgedCall(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	first, err := p.pick(serviceMethod, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stop waiting for reply which won't be used.
+	results := make(chan hedgeResult, 2)
+	send := func(m *poolMember) {
+		start := time.Now()
+		var res hedgeResult
+		if reply == nil {
+			res.err = m.client.CallContext(ctx, serviceMethod, args, nil)
+		} else {
+			res.err = m.client.CallContext(ctx, serviceMethod, args, &res.raw)
+		}
+		p.check(res.err)
+		if res.err == nil {
+			p.latency.add(time.Since(start))
+		}
+		results <- res
+	}
+	go send(first)
+	sent := 1
+
+	timer := time.NewTimer(p.hedgeDelay())
+	defer timer.Stop()
+	var res hedgeResult
+	for received := 0; received < sent; {
+		select {
+		case <-timer.C:
+			if second, err := p.pick(serviceMethod, first); err == nil {
+				go send(second)
+				sent++
+			}
+			continue
+		case res = <-results:
+			received++
+		}
+		if res.err == nil {
+			break
+		}
+	}
+	if res.err != nil || reply == nil {
+		return res.err
+	}
+	if err := json.Unmarshal(res.raw, reply); err != nil {
+		return NewError(errInternal.Code, err.Error())
+	}
+	return nil
+}
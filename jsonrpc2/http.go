@@ -4,20 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"mime"
 	"net/http"
 	"net/rpc"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const contentType = "application/json"
 
-type contextKey int
-
-var httpRequestContextKey contextKey //nolint:gochecknoglobals
-
 // HTTPRequestFromContext returns HTTP request related to this RPC (if
 // you use HTTPHander to serve JSON RPC 2.0 over HTTP) or nil otherwise.
 func HTTPRequestFromContext(ctx context.Context) *http.Request {
@@ -26,9 +27,14 @@ func HTTPRequestFromContext(ctx context.Context) *http.Request {
 }
 
 type httpServerConn struct {
+	mu      sync.Mutex // protects res, replied, status, done
 	req     io.Reader
-	res     io.Writer
+	res     http.ResponseWriter
 	replied bool
+	stream  bool // send replies and notifications as Server-Sent Events
+	status  int  // HTTP status to use instead of 200 or 204
+	done    bool // handler returned, res must not be used
+	meta    *ResponseMetadata
 }
 
 func (conn *httpServerConn) Read(buf []byte) (int, error) {
@@ -36,16 +42,71 @@ func (conn *httpServerConn) Read(buf []byte) (int, error) {
 }
 
 func (conn *httpServerConn) Write(buf []byte) (int, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.done {
+		return 0, io.ErrClosedPipe
+	}
+	if !conn.replied {
+		conn.applyMeta()
+		if conn.status != 0 {
+			conn.res.WriteHeader(conn.status)
+		}
+	}
 	conn.replied = true
-	return conn.res.Write(buf)
+	if !conn.stream {
+		return conn.res.Write(buf)
+	}
+	if err := writeEvent(conn.res, buf); err != nil {
+		return 0, err
+	}
+	if f, ok := conn.res.(http.Flusher); ok {
+		f.Flush()
+	}
+	return len(buf), nil
 }
 
 func (conn *httpServerConn) Close() error {
 	return nil
 }
 
+// applyMeta sets response headers and status using metadata set by RPC
+// method, status set by handler has priority.
+func (conn *httpServerConn) applyMeta() {
+	if status := conn.meta.apply(conn.res.Header()); conn.status == 0 {
+		conn.status = status
+	}
+}
+
+// rateLimited implements rateLimited.
+func (conn *httpServerConn) rateLimited(retryAfter time.Duration) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.replied || conn.stream {
+		return
+	}
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	conn.res.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	conn.status = http.StatusTooManyRequests
+}
+
+// Notify implements Notifier.
+func (conn *httpServerConn) Notify(method string, params interface{}) error {
+	n, err := newServerNotification(method, params)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(n)
+	if err != nil {
+		return NewError(errInternal.Code, err.Error())
+	}
+	_, err = conn.Write(buf)
+	return err
+}
+
 type httpHandler struct {
 	rpc *rpc.Server
+	o   *options
 }
 
 // HTTPHandler returns handler for HTTP requests which will execute
@@ -53,33 +114,83 @@ type httpHandler struct {
 //
 // If srv is nil then rpc.DefaultServer will be used.
 //
+// If request's Accept header is "text/event-stream" then response will be
+// sent as a stream of Server-Sent Events: each notification sent by RPC
+// method using NotifierFromContext and final response will be sent as
+// a separate event.
+//
 // Specification: http://www.simple-is-better.org/json-rpc/transport_http.html
-func HTTPHandler(srv *rpc.Server) http.Handler {
+func HTTPHandler(srv *rpc.Server, opts ...Option) http.Handler {
 	if srv == nil {
 		srv = rpc.DefaultServer
 	}
-	return &httpHandler{srv}
+	return &httpHandler{rpc: srv, o: newOptions(opts)}
 }
 
 func (h *httpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	status := h.serveHTTP(w, req)
+	if h.o.metrics != nil {
+		h.o.metrics.HTTPStatus(ServerSide, status)
+	}
+}
+
+// serveHTTP handles request and returns HTTP status of response.
+func (h *httpHandler) serveHTTP(w http.ResponseWriter, req *http.Request) int {
 	w.Header().Set("Content-Type", contentType)
 
 	if req.Method != "POST" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
+		return http.StatusMethodNotAllowed
 	}
 	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
-	if mediaType != contentType || req.Header.Get("Accept") != contentType {
+	accept := req.Header.Get("Accept")
+	if mediaType != contentType || (accept != contentType && accept != contentTypeStream) {
 		w.WriteHeader(http.StatusUnsupportedMediaType)
-		return
+		return http.StatusUnsupportedMediaType
 	}
 
 	ctx := context.WithValue(context.Background(), httpRequestContextKey, req)
-	conn := &httpServerConn{req: req.Body, res: w}
-	_ = h.rpc.ServeRequest(NewServerCodecContext(ctx, conn, h.rpc))
+	if sc, err := ParseTraceparent(req.Header.Get(traceparentHeader)); err == nil {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+	if h.o.propagateDeadline {
+		var cancel context.CancelFunc
+		if ctx, cancel = withTimeout(ctx, req.Header.Get(timeoutHeader)); cancel != nil {
+			defer cancel()
+		}
+	}
+	ctx, authErr := h.authenticateHTTP(ctx, req)
+	if authErr != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(serverResponse{Version: protoVer, ID: &null, Error: authErr})
+		return http.StatusUnauthorized
+	}
+	conn := &httpServerConn{req: req.Body, res: w, meta: newResponseMetadata(false)}
+	ctx = context.WithValue(ctx, responseMetadataContextKey, conn.meta)
+	if accept == contentTypeStream {
+		w.Header().Set("Content-Type", contentTypeStream)
+		w.Header().Set("Cache-Control", "no-cache")
+		conn.stream = true
+		ctx = context.WithValue(ctx, notifierContextKey, Notifier(conn))
+	}
+	serveRequest(h.rpc, newServerCodec(ctx, conn, h.rpc, h.o))
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.done = true
 	if !conn.replied {
+		conn.applyMeta()
+	}
+	switch {
+	case !conn.replied && conn.status != 0:
+		w.WriteHeader(conn.status)
+		return conn.status
+	case !conn.replied:
 		w.WriteHeader(http.StatusNoContent)
+		return http.StatusNoContent
+	case conn.status != 0:
+		return conn.status
 	}
+	return http.StatusOK
 }
 
 // Doer is an interface for doing HTTP requests.
@@ -98,95 +209,300 @@ func (f DoerFunc) Do(req *http.Request) (resp *http.Response, err error) {
 }
 
 type httpClientConn struct {
-	url   string
-	doer  Doer
-	ready chan io.ReadCloser
-	body  io.ReadCloser
-	close chan struct{}
+	url     string
+	doer    Doer
+	log     Logger
+	metrics Metrics
+	slots   chan struct{} // limits amount of in-flight requests
+	closing chan struct{} // closed by Close
+	wg      sync.WaitGroup
+
+	deadlines bool // send call's deadline in header
+
+	mu      sync.Mutex // protects calls, replies, closed
+	calls   map[*httpCall]struct{}
+	replies []*httpReply
+	ready   chan struct{} // signaled when replies is not empty
+	closed  bool
+
+	reply *httpReply // currently read by Read
+}
+
+// httpCall is an in-flight HTTP request.
+type httpCall struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	id     *json.RawMessage // nil for Notification
+	body   []byte
+}
+
+// httpReply is a response to httpCall waiting to be read.
+type httpReply struct {
+	body *bytes.Reader
+}
+
+func newHTTPClientConn(url string, doer Doer, opts *options) *httpClientConn {
+	maxInFlight := opts.maxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+	return &httpClientConn{
+		url:     url,
+		doer:    doer,
+		log:     opts.logger,
+		metrics: opts.metrics,
+		slots:   make(chan struct{}, maxInFlight),
+		closing: make(chan struct{}),
+		calls:   make(map[*httpCall]struct{}),
+		ready:   make(chan struct{}, 1),
+
+		deadlines: opts.propagateDeadline,
+	}
 }
 
 func (conn *httpClientConn) Read(buf []byte) (int, error) {
-	if conn.body == nil {
+	for conn.reply == nil {
+		conn.mu.Lock()
+		if len(conn.replies) > 0 {
+			conn.reply = conn.replies[0]
+			conn.replies[0] = nil
+			conn.replies = conn.replies[1:]
+		}
+		conn.mu.Unlock()
+		if conn.reply != nil {
+			break
+		}
 		select {
-		case <-conn.close:
+		case <-conn.closing:
 			return 0, io.EOF
-		case conn.body = <-conn.ready:
+		case <-conn.ready:
 		}
 	}
-	n, err := conn.body.Read(buf)
-	if err == io.EOF {
-		logIfFail(conn.body.Close)
-		conn.body = nil
-		err = nil
-		if n == 0 {
-			return conn.Read(buf)
-		}
+	n, _ := conn.reply.body.Read(buf)
+	if conn.reply.body.Len() == 0 {
+		conn.reply = nil
+		<-conn.slots
 	}
-	return n, err
+	return n, nil
 }
 
 func (conn *httpClientConn) Write(buf []byte) (int, error) {
-	b := make([]byte, len(buf))
-	copy(b, buf)
-	go func() {
-		req, err := http.NewRequest("POST", conn.url, bytes.NewReader(b))
-		if err == nil {
-			req.Header.Add("Content-Type", contentType)
-			req.Header.Add("Accept", contentType)
-			var resp *http.Response
-			resp, err = conn.doer.Do(req)
-			const maxBodySlurpSize = 32 * 1024
-
-			if err == nil {
-				mediaType, _, err2 := mime.ParseMediaType(resp.Header.Get("Content-Type"))
-				switch {
-				case mediaType != contentType || err2 != nil:
-					err = fmt.Errorf("bad HTTP Content-Type: %s", resp.Header.Get("Content-Type"))
-				case resp.StatusCode == http.StatusOK:
-					conn.ready <- resp.Body
-					return
-				case resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusAccepted:
-					// Read the body if small so underlying TCP connection will be re-used.
-					// No need to check for errors: if it fails, Transport won't reuse it anyway.
-					if resp.ContentLength == -1 || resp.ContentLength <= maxBodySlurpSize {
-						_, _ = io.CopyN(ioutil.Discard, resp.Body, maxBodySlurpSize)
-					}
-					logIfFail(resp.Body.Close)
-					return
-				default:
-					err = fmt.Errorf("bad HTTP Status: %s", resp.Status)
-				}
-			}
-			if resp != nil {
-				// Read the body if small so underlying TCP connection will be re-used.
-				// No need to check for errors: if it fails, Transport won't reuse it anyway.
-				if resp.ContentLength == -1 || resp.ContentLength <= maxBodySlurpSize {
-					_, _ = io.CopyN(ioutil.Discard, resp.Body, maxBodySlurpSize)
-				}
-				logIfFail(resp.Body.Close)
-			}
+	if err := conn.writeRequest(context.Background(), buf); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// writeRequest implements requestWriter.
+//
+// It blocks while there are too many in-flight requests.
+func (conn *httpClientConn) writeRequest(ctx context.Context, buf []byte) error {
+	select {
+	case conn.slots <- struct{}{}:
+	case <-conn.closing:
+		return rpc.ErrShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	call := &httpCall{body: make([]byte, len(buf))}
+	copy(call.body, buf)
+	var req struct {
+		ID *json.RawMessage `json:"id"`
+	}
+	_ = json.Unmarshal(call.body, &req)
+	call.id = req.ID
+	call.ctx, call.cancel = context.WithCancel(ctx)
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.closed {
+		call.cancel()
+		<-conn.slots
+		return rpc.ErrShutdown
+	}
+	conn.calls[call] = struct{}{}
+	conn.wg.Add(1)
+	go conn.do(call)
+	return nil
+}
+
+func (conn *httpClientConn) do(call *httpCall) {
+	defer conn.wg.Done()
+	defer func() {
+		conn.mu.Lock()
+		delete(conn.calls, call)
+		conn.mu.Unlock()
+		call.cancel()
+	}()
+
+	reply, err := conn.roundTrip(call)
+	if err != nil && call.ctx.Err() == nil {
+		conn.log.Warn("HTTP request failed", "url", conn.url, "err", err)
+	}
+	if err != nil && call.id != nil {
+		reply = newHTTPErrorReply(call.id, err)
+	}
+	if reply == nil { // Notification or error from Notification.
+		<-conn.slots
+		return
+	}
+
+	conn.mu.Lock()
+	conn.replies = append(conn.replies, &httpReply{body: bytes.NewReader(reply)})
+	conn.mu.Unlock()
+	select {
+	case conn.ready <- struct{}{}:
+	default:
+	}
+}
+
+// roundTrip sends call and returns received response, if any.
+func (conn *httpClientConn) roundTrip(call *httpCall) ([]byte, error) {
+	notifications, _ := call.ctx.Value(notificationsContextKey).(chan<- *Notification)
+	accept := contentType
+	if notifications != nil {
+		accept = contentTypeStream
+	}
+	req, err := http.NewRequestWithContext(call.ctx, "POST", conn.url, bytes.NewReader(call.body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", contentType)
+	req.Header.Add("Accept", accept)
+	if sc, ok := SpanContextFromContext(call.ctx); ok && sc.IsValid() {
+		req.Header.Set(traceparentHeader, sc.Traceparent())
+	}
+	if timeout, ok := timeoutFromContext(call.ctx); ok && conn.deadlines {
+		req.Header.Set(timeoutHeader, timeout)
+	}
+	resp, err := conn.doer.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if conn.metrics != nil {
+		conn.metrics.HTTPStatus(ClientSide, resp.StatusCode)
+	}
+	if rh, ok := call.ctx.Value(responseHeaderContextKey).(*ResponseHeader); ok {
+		rh.set(resp.Header)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case err != nil || !(mediaType == contentType || mediaType == accept):
+		err = fmt.Errorf("bad HTTP Content-Type: %s", resp.Header.Get("Content-Type"))
+	case resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusAccepted && call.id == nil:
+		if call.id != nil {
+			err = fmt.Errorf("bad HTTP Status: %s", resp.Status)
 		}
-		var res clientResponse
-		if json.Unmarshal(b, &res) == nil && res.ID == nil {
-			return // ignore error from Notification
+	case isSuccess(resp.StatusCode) && mediaType == contentTypeStream:
+		defer logIfFail(conn.log, resp.Body.Close)
+		return readStream(call.ctx, resp.Body, notifications)
+	case isSuccess(resp.StatusCode): // RPC method may set status (see ResponseMetadata).
+		defer logIfFail(conn.log, resp.Body.Close)
+		return ioutil.ReadAll(resp.Body)
+	case resp.StatusCode >= http.StatusBadRequest && mediaType == contentType:
+		err = httpStatusError(resp)
+	default:
+		err = fmt.Errorf("bad HTTP Status: %s", resp.Status)
+	}
+	discardBody(conn.log, resp)
+	return nil, err
+}
+
+// isSuccess returns true for 2xx HTTP status.
+func isSuccess(status int) bool {
+	return status >= http.StatusOK && status < http.StatusMultipleChoices
+}
+
+// readStream sends notifications received from Server-Sent Events stream
+// to notifications and returns response.
+func readStream(ctx context.Context, r io.Reader, notifications chan<- *Notification) (reply []byte, err error) {
+	err = readEvents(r, func(data []byte) error {
+		if !isNotification(data) {
+			reply = data
+			return io.EOF
 		}
-		res.Error = NewError(errInternal.Code, err.Error())
-		buf := &bytes.Buffer{}
-		_ = json.NewEncoder(buf).Encode(res)
-		conn.ready <- ioutil.NopCloser(buf)
-	}()
-	return len(buf), nil
+		n := new(Notification)
+		if err := json.Unmarshal(data, n); err != nil {
+			return err
+		}
+		select {
+		case notifications <- n:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	switch {
+	case reply != nil:
+		return reply, nil
+	case err == nil:
+		return nil, io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// httpStatusError returns error from JSON-RPC response in resp's body
+// (if any) or error with HTTP status.
+func httpStatusError(resp *http.Response) error {
+	const maxBodySize = 64 << 10
+	var reply struct {
+		Error *Error `json:"error"`
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err == nil && json.Unmarshal(body, &reply) == nil && reply.Error != nil {
+		return reply.Error
+	}
+	return fmt.Errorf("bad HTTP Status: %s", resp.Status)
 }
 
+// newHTTPErrorReply returns response with given id and error.
+func newHTTPErrorReply(id *json.RawMessage, err error) []byte {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = NewError(errInternal.Code, err.Error())
+	}
+	buf, _ := json.Marshal(serverResponse{
+		Version: protoVer,
+		ID:      id,
+		Error:   e,
+	})
+	return append(buf, '\n')
+}
+
+// discardBody reads the body if small so underlying TCP connection will
+// be re-used and then close it.
+func discardBody(l Logger, resp *http.Response) {
+	const maxBodySlurpSize = 32 * 1024
+	// No need to check for errors: if it fails, Transport won't reuse it anyway.
+	if resp.ContentLength == -1 || resp.ContentLength <= maxBodySlurpSize {
+		_, _ = io.CopyN(ioutil.Discard, resp.Body, maxBodySlurpSize)
+	}
+	logIfFail(l, resp.Body.Close)
+}
+
+// Close cancels all in-flight requests and waits until they'll finish.
 func (conn *httpClientConn) Close() error {
-	close(conn.close)
+	conn.mu.Lock()
+	if conn.closed {
+		conn.mu.Unlock()
+		return nil
+	}
+	conn.closed = true
+	close(conn.closing)
+	for call := range conn.calls {
+		call.cancel()
+	}
+	conn.mu.Unlock()
+	conn.wg.Wait()
 	return nil
 }
 
 // NewHTTPClient returns a new Client to handle requests to the
 // set of services at the given url.
-func NewHTTPClient(url string) *Client {
-	return NewCustomHTTPClient(url, nil)
+func NewHTTPClient(url string, opts ...Option) *Client {
+	return NewCustomHTTPClient(url, nil, opts...)
 }
 
 // NewCustomHTTPClient returns a new Client to handle requests to the
@@ -196,14 +512,15 @@ func NewHTTPClient(url string) *Client {
 // Use doer to customize HTTP authorization/headers/etc. sent with each
 // request (it method Do() will receive already configured POST request
 // with url, all required headers and body set according to specification).
-func NewCustomHTTPClient(url string, doer Doer) *Client {
+//
+// Each request is sent in a separate HTTP request. Amount of concurrent
+// HTTP requests is limited (see WithMaxInFlight), client's calls will
+// block while limit is reached. Close will cancel all in-flight HTTP
+// requests.
+func NewCustomHTTPClient(url string, doer Doer, opts ...Option) *Client {
 	if doer == nil {
 		doer = &http.Client{}
 	}
-	return NewClient(&httpClientConn{
-		url:   url,
-		doer:  doer,
-		ready: make(chan io.ReadCloser, 16),
-		close: make(chan struct{}),
-	})
+	o := newOptions(opts)
+	return newClient(newClientCodec(newHTTPClientConn(url, doer, o), o), o)
 }
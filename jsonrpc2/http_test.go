@@ -11,8 +11,11 @@ import (
 	"net/http/httptest"
 	"net/rpc"
 	"reflect"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/powerman/rpc-codec/jsonrpc2"
 )
@@ -173,3 +176,114 @@ func TestHTTPClientContentType(t *testing.T) {
 		ts.Close()
 	}
 }
+
+// BlockSvc is an RPC service for testing.
+type BlockSvc struct {
+	mu       sync.Mutex
+	cur, max int
+	release  chan struct{}
+}
+
+type BlockArgs struct {
+	jsonrpc2.Ctx
+}
+
+func (s *BlockSvc) Wait(args BlockArgs, res *int) error {
+	s.mu.Lock()
+	s.cur++
+	if s.cur > s.max {
+		s.max = s.cur
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cur--
+		s.mu.Unlock()
+	}()
+	select {
+	case <-s.release:
+	case <-jsonrpc2.HTTPRequestFromContext(args.Context()).Context().Done():
+	}
+	return nil
+}
+
+func newBlockServer(t *testing.T) (*BlockSvc, *httptest.Server) {
+	t.Helper()
+	svc := &BlockSvc{release: make(chan struct{})}
+	srv := rpc.NewServer()
+	if err := srv.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	return svc, httptest.NewServer(jsonrpc2.HTTPHandler(srv))
+}
+
+func waitGoroutines(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(3 * time.Second); runtime.NumGoroutine() > n && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > n {
+		buf := make([]byte, 1<<20)
+		t.Errorf("goroutines = %d, want <= %d\n%s", got, n, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestHTTPClientCloseLeak(t *testing.T) {
+	base := runtime.NumGoroutine()
+	_, ts := newBlockServer(t)
+	tr := &http.Transport{}
+	client := jsonrpc2.NewCustomHTTPClient(ts.URL, &http.Client{Transport: tr})
+
+	const n = 5
+	done := make(chan *rpc.Call, n)
+	for i := 0; i < n; i++ {
+		client.Go("BlockSvc.Wait", nil, nil, done)
+	}
+	client.Notify("BlockSvc.Wait", nil)
+	time.Sleep(50 * time.Millisecond)
+	client.Close()
+	for i := 0; i < n; i++ {
+		select {
+		case call := <-done:
+			if call.Error != rpc.ErrShutdown {
+				t.Errorf("Go(), err = %v, want = %v", call.Error, rpc.ErrShutdown)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("call is not done after Close")
+		}
+	}
+	if err := client.Notify("BlockSvc.Wait", nil); err == nil {
+		t.Errorf("Notify() after Close, err = nil")
+	}
+
+	tr.CloseIdleConnections()
+	ts.Close()
+	waitGoroutines(t, base)
+}
+
+func TestHTTPClientMaxInFlight(t *testing.T) {
+	svc, ts := newBlockServer(t)
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL, jsonrpc2.WithMaxInFlight(2))
+	defer client.Close()
+
+	const n = 6
+	done := make(chan *rpc.Call, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			client.Go("BlockSvc.Wait", nil, nil, done)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(svc.release)
+	for i := 0; i < n; i++ {
+		if call := <-done; call.Error != nil {
+			t.Errorf("Go(), err = %v", call.Error)
+		}
+	}
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if svc.max != 2 {
+		t.Errorf("max in-flight = %d, want = 2", svc.max)
+	}
+}
@@ -0,0 +1,66 @@
+package jsonrpc2
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// IDGenerator returns ID for request with given net/rpc sequence number.
+// ID must be a string or a number and should be unique among pending
+// requests of a client.
+type IDGenerator func(seq uint64) interface{}
+
+// SeqID is an IDGenerator which uses sequence number as ID.
+// This is default IDGenerator.
+func SeqID(seq uint64) interface{} {
+	return seq
+}
+
+// UUIDID is an IDGenerator which uses random UUID (version 4) as ID.
+func UUIDID(uint64) interface{} {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// PrefixID returns IDGenerator which uses sequence number with given
+// prefix as ID, e.g. "prefix-42". It may be used to correlate requests
+// with client in server's logs.
+func PrefixID(prefix string) IDGenerator {
+	return func(seq uint64) interface{} {
+		return prefix + strconv.FormatUint(seq, 10)
+	}
+}
+
+// idKey returns normalized ID which can be used to match response with
+// request. Numbers and strings containing same number have same key,
+// so response will match even if server (or proxy) convert number ID to
+// string.
+func idKey(raw json.RawMessage) (string, bool) {
+	if n, err := strconv.ParseUint(string(raw), 10, 64); err == nil {
+		return strconv.FormatUint(n, 10), true
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", false
+	}
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case float64:
+		s = string(raw)
+	default:
+		return "", false
+	}
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return strconv.FormatUint(n, 10), true
+	}
+	return s, true
+}
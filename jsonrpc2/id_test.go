@@ -0,0 +1,72 @@
+// nolint:errcheck
+package jsonrpc2
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+)
+
+func TestIDKey(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{`0`, "0", true},
+		{`42`, "42", true},
+		{`"42"`, "42", true},
+		{`1.5`, "1.5", true},
+		{`"str"`, "str", true},
+		{`null`, "", false},
+		{`true`, "", false},
+		{`[0]`, "", false},
+		{`{}`, "", false},
+	}
+	for _, c := range cases {
+		got, ok := idKey(json.RawMessage(c.in))
+		if got != c.want || ok != c.ok {
+			t.Errorf("idKey(%s) = %q, %v, want = %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestIDGenerator(t *testing.T) {
+	cases := []struct {
+		gen  IDGenerator
+		want string
+	}{
+		{nil, `^0$`},
+		{SeqID, `^0$`},
+		{UUIDID, `^"[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"$`},
+		{PrefixID("cli-"), `^"cli-0"$`},
+	}
+	for _, c := range cases {
+		cli, srv := net.Pipe()
+		client := NewClient(cli, WithIDGenerator(c.gen))
+
+		go func() {
+			var req struct{ ID json.RawMessage }
+			line, _ := bufio.NewReader(srv).ReadBytes('\n')
+			json.Unmarshal(line, &req)
+			if !regexp.MustCompile(c.want).Match(req.ID) {
+				t.Errorf("id = %s, want match %#q", req.ID, c.want)
+			}
+			id, _ := json.Marshal(string(req.ID)) // Server returns any id as string.
+			if req.ID[0] == '"' {
+				id = req.ID
+			}
+			fmt.Fprintf(srv, `{"jsonrpc":"2.0","id":%s,"result":42}`+"\n", id)
+		}()
+
+		var got int
+		if err := client.Call("method", nil, &got); err != nil || got != 42 {
+			t.Errorf("Call() = %v, %v, want = 42, nil", got, err)
+		}
+		client.Close()
+		srv.Close()
+	}
+}
@@ -0,0 +1,87 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+var (
+	errTooLarge = errors.New("message too large")
+
+	errMsgTooLarge   = NewError(-32700, "parse error: message too large")
+	errTooDeep       = NewError(-32600, "invalid request: nesting too deep")
+	errBatchTooLarge = NewError(-32600, "invalid request: batch too large")
+)
+
+// limitReader returns errTooLarge when trying to read after limit
+// (absolute offset in r, 0 means no limit).
+type limitReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitReader) Read(buf []byte) (int, error) {
+	if l.limit > 0 {
+		if l.n >= l.limit {
+			return 0, errTooLarge
+		}
+		if left := l.limit - l.n; int64(len(buf)) > left {
+			buf = buf[:left]
+		}
+	}
+	n, err := l.r.Read(buf)
+	l.n += int64(n)
+	return n, err
+}
+
+// jsonDepth returns max nesting depth of arrays and objects in valid
+// JSON value.
+func jsonDepth(raw []byte) int {
+	depth, maxDepth := 0, 0
+	inString := false
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '[' || c == '{':
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return maxDepth
+}
+
+// jsonArrayLen returns amount of elements in valid JSON array.
+func jsonArrayLen(raw []byte) int {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) < 2 || len(bytes.TrimSpace(raw[1:len(raw)-1])) == 0 {
+		return 0
+	}
+	depth, n := 0, 1
+	inString := false
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 1:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,173 @@
+// nolint:errcheck
+package jsonrpc2
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SlowSvc is an RPC service for testing.
+type SlowSvc struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *SlowSvc) Wait(_ struct{}, _ *struct{}) error {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *SlowSvc) Sleep(ms [1]int, res *int) error {
+	time.Sleep(time.Duration(ms[0]) * time.Millisecond)
+	*res = ms[0]
+	return nil
+}
+
+func TestJSONScan(t *testing.T) {
+	cases := []struct {
+		in    string
+		depth int
+		len   int
+	}{
+		{`1`, 0, 0},
+		{`[]`, 1, 0},
+		{` [ ] `, 1, 0},
+		{`[1]`, 1, 1},
+		{`["a,b"]`, 1, 1},
+		{`["a\",[b"]`, 1, 1},
+		{`[[1],[2,3]]`, 2, 2},
+		{`[{"a":[1,2]},{"b":{}},3]`, 3, 3},
+		{`{"a":"\\"}`, 1, 0},
+	}
+	for _, v := range cases {
+		if depth := jsonDepth([]byte(v.in)); depth != v.depth {
+			t.Errorf("jsonDepth(%#q) = %d, want %d", v.in, depth, v.depth)
+		}
+		if !strings.HasPrefix(strings.TrimSpace(v.in), "[") {
+			continue
+		}
+		if n := jsonArrayLen([]byte(v.in)); n != v.len {
+			t.Errorf("jsonArrayLen(%#q) = %d, want %d", v.in, n, v.len)
+		}
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	big := `{"jsonrpc":"2.0","id":1,"method":"Svc.SumAll","params":[` +
+		strings.Repeat("1,", 100) + `1]}`
+	cases := []struct {
+		opt    Option
+		in     []string
+		want   []string
+		closed bool
+	}{
+		{
+			WithMaxMessageSize(128),
+			[]string{
+				`{"jsonrpc":"2.0","id":0,"method":"Svc.Sum","params":[1,2]}`,
+				big,
+			},
+			[]string{
+				`{"jsonrpc":"2.0","id":0,"result":3}`,
+				`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error: message too large"}}`,
+			},
+			true,
+		},
+		{
+			WithMaxDepth(2),
+			[]string{
+				`{"jsonrpc":"2.0","id":0,"method":"Svc.Sum","params":[1,2]}`,
+				`{"jsonrpc":"2.0","id":1,"method":"Svc.Sum","params":[[1],2]}`,
+			},
+			[]string{
+				`{"jsonrpc":"2.0","id":0,"result":3}`,
+				`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request: nesting too deep"}}`,
+			},
+			true,
+		},
+		{
+			WithMaxBatchLen(2),
+			[]string{
+				`[{"jsonrpc":"2.0","method":"Svc.Sum","params":[1,2]},{"jsonrpc":"2.0","method":"Svc.Sum","params":[1,2]},{"jsonrpc":"2.0","method":"Svc.Sum","params":[1,2]}]`,
+				`[{"jsonrpc":"2.0","id":0,"method":"Svc.Sum","params":[1,2]}]`,
+			},
+			[]string{
+				`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request: batch too large"}}`,
+				`[{"jsonrpc":"2.0","id":0,"result":3}]`,
+			},
+			false,
+		},
+	}
+	for _, c := range cases {
+		cli, srv := net.Pipe()
+		go rpc.ServeCodec(NewServerCodec(srv, nil, c.opt))
+		buf := bufio.NewReader(cli)
+		for i, line := range c.in {
+			go cli.Write([]byte(line + "\n"))
+			got, err := buf.ReadString('\n')
+			if err != nil {
+				t.Errorf("recv err = %v, want %#q", err, c.want[i])
+				break
+			}
+			if got = strings.TrimRight(got, "\n"); got != c.want[i] {
+				t.Errorf("\nwant: %#q\nrecv: %#q", c.want[i], got)
+			}
+		}
+		cli.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err := buf.ReadString('\n')
+		if closed := err == io.EOF; closed != c.closed {
+			t.Errorf("%#q: closed = %v, want %v (err = %v)", c.want[len(c.want)-1], closed, c.closed, err)
+		}
+		cli.Close()
+	}
+}
+
+func TestServerMaxInFlight(t *testing.T) {
+	cases := []struct {
+		opt     Option
+		limited bool
+	}{
+		{WithMaxConcurrentRequests(2), true},
+		{WithMaxInFlight(2), false}, // Client-only option.
+	}
+	for _, c := range cases {
+		svc := &SlowSvc{}
+		srv := rpc.NewServer()
+		srv.Register(svc)
+		cli, conn := net.Pipe()
+		go srv.ServeCodec(NewServerCodec(conn, srv, c.opt))
+		client := NewClient(cli)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := client.Call("SlowSvc.Wait", struct{}{}, nil); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		client.Close()
+		if (svc.maxInFlight <= 2) != c.limited {
+			t.Errorf("maxInFlight = %d, limited = %v", svc.maxInFlight, c.limited)
+		}
+	}
+}
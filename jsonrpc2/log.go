@@ -1,9 +1,53 @@
 package jsonrpc2
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"strings"
+)
 
-func logIfFail(f func() error) {
+// Logger is an interface for leveled structured logging used by client
+// and server. It is compatible with *slog.Logger: args are alternating
+// keys and values.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// stdLogger logs errors using standard log package and ignores all other
+// levels. It is used when Logger isn't configured by WithLogger.
+type stdLogger struct{}
+
+func (stdLogger) Debug(string, ...any) {}
+func (stdLogger) Info(string, ...any)  {}
+func (stdLogger) Warn(string, ...any)  {}
+
+func (stdLogger) Error(msg string, args ...any) {
+	var buf strings.Builder
+	buf.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&buf, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&buf, " %v", args[i])
+		}
+	}
+	log.Print(buf.String())
+}
+
+func logIfFail(l Logger, f func() error) {
 	if err := f(); err != nil {
-		log.Print(err)
+		l.Error("close failed", "err", err)
+	}
+}
+
+// truncate returns data as string, truncated if it's too long for log.
+func truncate(data []byte) string {
+	const maxLen = 256
+	if len(data) > maxLen {
+		return string(data[:maxLen]) + "…"
 	}
+	return string(data)
 }
@@ -0,0 +1,86 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// RecordLogger is a jsonrpc2.Logger for testing.
+type RecordLogger struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (l *RecordLogger) log(level, msg string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec := level + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "duration" {
+			continue
+		}
+		rec += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	l.records = append(l.records, rec)
+}
+
+func (l *RecordLogger) Debug(msg string, args ...any) { l.log("DEBUG", msg, args...) }
+func (l *RecordLogger) Info(msg string, args ...any)  { l.log("INFO", msg, args...) }
+func (l *RecordLogger) Warn(msg string, args ...any)  { l.log("WARN", msg, args...) }
+func (l *RecordLogger) Error(msg string, args ...any) { l.log("ERROR", msg, args...) }
+
+func (l *RecordLogger) Records() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.records...)
+}
+
+func TestServerLogger(t *testing.T) {
+	log := &RecordLogger{}
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	done := make(chan struct{})
+	go func() {
+		rpc.ServeCodec(jsonrpc2.NewServerCodec(srv, nil, jsonrpc2.WithLogger(log), jsonrpc2.WithAccessLog()))
+		close(done)
+	}()
+
+	r := bufio.NewReader(cli)
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"Svc.Sum","params":[3,5]}`,
+		`{"jsonrpc":"2.0","method":"Svc.Sum","params":[3,5]}`,
+		`{"jsonrpc":"2.0","id":"a","method":"Svc.Missing"}`,
+		`{"jsonrpc":"2.0","id":2}`,
+	} {
+		cli.Write([]byte(req + "\n"))
+		if !strings.Contains(req, `"id"`) {
+			continue
+		}
+		if _, err := r.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cli.Close()
+	<-done
+
+	want := []string{ // Sorted, because calls are processed concurrently.
+		`INFO call method=Svc.Missing id="a" code=-32601`,
+		`INFO call method=Svc.Sum id= code=0`,
+		`INFO call method=Svc.Sum id=1 code=0`,
+		`WARN invalid request request={"jsonrpc":"2.0","id":2}`,
+	}
+	got := log.Records()
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("log:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
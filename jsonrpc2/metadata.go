@@ -0,0 +1,55 @@
+package jsonrpc2
+
+import "context"
+
+// Metadata is an additional information sent by client with request,
+// like HTTP headers (e.g. auth token or tenant ID).
+//
+// Metadata is sent only if both client and server use WithMetaMember.
+// Keys "traceparent" and "timeout" are reserved.
+type Metadata map[string]string
+
+// ContextWithMetadata returns a copy of ctx with md, which will be sent
+// to server by client calls made with this ctx.
+//
+// Metadata received by server isn't sent by client calls made with
+// request context, it must be added explicitly to be forwarded.
+func ContextWithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, outgoingMetadataContextKey, md)
+}
+
+// MetadataFromContext returns metadata received by server from client,
+// which is provided in request context.
+//
+// It doesn't return metadata set by ContextWithMetadata.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(incomingMetadataContextKey).(Metadata)
+	return md
+}
+
+// outgoingMetadata returns metadata to send with call made using ctx.
+func outgoingMetadata(ctx context.Context) Metadata {
+	md, _ := ctx.Value(outgoingMetadataContextKey).(Metadata)
+	return md
+}
+
+// isReservedMeta returns true if key in object with metadata is used
+// by this package.
+func isReservedMeta(key string) bool {
+	return key == traceparentMeta || key == timeoutMeta
+}
+
+// requestMetadata returns metadata received with current request.
+func requestMetadata(meta map[string]string) Metadata {
+	var md Metadata
+	for k, v := range meta {
+		if isReservedMeta(k) {
+			continue
+		}
+		if md == nil {
+			md = make(Metadata, len(meta))
+		}
+		md[k] = v
+	}
+	return md
+}
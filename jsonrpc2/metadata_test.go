@@ -0,0 +1,110 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"reflect"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// MetaSvc is an RPC service for testing.
+type MetaSvc struct{}
+
+type MetaArg struct{ jsonrpc2.Ctx }
+
+// Get returns received metadata.
+func (MetaSvc) Get(arg MetaArg, res *jsonrpc2.Metadata) error {
+	*res = jsonrpc2.MetadataFromContext(arg.Context())
+	return nil
+}
+
+func TestMetadata(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(MetaSvc{})
+	dial := func(server, client []jsonrpc2.Option) *jsonrpc2.Client {
+		cli, conn := net.Pipe()
+		go srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv, server...))
+		return jsonrpc2.NewClient(cli, client...)
+	}
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv, jsonrpc2.WithMetaMember("_meta")))
+	defer ts.Close()
+
+	opts := []jsonrpc2.Option{jsonrpc2.WithMetaMember("_meta")}
+	md := jsonrpc2.Metadata{"tenant": "acme", "token": "secret", "traceparent": "bad"}
+	ctx := jsonrpc2.ContextWithMetadata(context.Background(), md)
+	want := jsonrpc2.Metadata{"tenant": "acme", "token": "secret"}
+
+	for name, client := range map[string]*jsonrpc2.Client{
+		"stream": dial(opts, opts),
+		"http":   jsonrpc2.NewHTTPClient(ts.URL, opts...),
+	} {
+		var res jsonrpc2.Metadata
+		if err := client.CallContext(ctx, "MetaSvc.Get", nil, &res); err != nil || !reflect.DeepEqual(res, want) {
+			t.Errorf("%s: Get() = %v, %v", name, res, err)
+		}
+		res = nil
+		if err := client.Call("MetaSvc.Get", nil, &res); err != nil || res != nil {
+			t.Errorf("%s: without metadata: Get() = %v, %v", name, res, err)
+		}
+		client.Close()
+	}
+
+	client := dial(nil, opts)
+	defer client.Close()
+	var res jsonrpc2.Metadata
+	if err := client.Call("MetaSvc.Get", nil, &res); err != nil || res != nil {
+		t.Errorf("server disabled, without metadata: Get() = %v, %v", res, err)
+	}
+	rpcerr := jsonrpc2.ServerError(client.CallContext(ctx, "MetaSvc.Get", nil, &res))
+	if rpcerr == nil || rpcerr.Code != -32600 {
+		t.Errorf("server disabled: err = %v", rpcerr)
+	}
+}
+
+// RelaySvc is an RPC service for testing.
+type RelaySvc struct{ next *jsonrpc2.Client }
+
+// Get returns metadata received by MetaSvc.Get called with request
+// context.
+func (svc *RelaySvc) Get(arg MetaArg, res *jsonrpc2.Metadata) error {
+	return svc.next.CallContext(arg.Context(), "MetaSvc.Get", nil, res)
+}
+
+// Forward returns metadata received by MetaSvc.Get called with
+// explicitly forwarded metadata.
+func (svc *RelaySvc) Forward(arg MetaArg, res *jsonrpc2.Metadata) error {
+	ctx := jsonrpc2.ContextWithMetadata(arg.Context(), jsonrpc2.MetadataFromContext(arg.Context()))
+	return svc.next.CallContext(ctx, "MetaSvc.Get", nil, res)
+}
+
+func TestMetadataRelay(t *testing.T) {
+	opts := []jsonrpc2.Option{jsonrpc2.WithMetaMember("_meta")}
+	dial := func(srv *rpc.Server) *jsonrpc2.Client {
+		cli, conn := net.Pipe()
+		go srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv, opts...))
+		return jsonrpc2.NewClient(cli, opts...)
+	}
+	downstream := rpc.NewServer()
+	downstream.Register(MetaSvc{})
+	next := dial(downstream)
+	defer next.Close()
+	relay := rpc.NewServer()
+	relay.Register(&RelaySvc{next: next})
+	client := dial(relay)
+	defer client.Close()
+
+	md := jsonrpc2.Metadata{"token": "secret"}
+	ctx := jsonrpc2.ContextWithMetadata(context.Background(), md)
+	var res jsonrpc2.Metadata
+	if err := client.CallContext(ctx, "RelaySvc.Get", nil, &res); err != nil || res != nil {
+		t.Errorf("Get() = %v, %v", res, err)
+	}
+	if err := client.CallContext(ctx, "RelaySvc.Forward", nil, &res); err != nil || !reflect.DeepEqual(res, md) {
+		t.Errorf("Forward() = %v, %v", res, err)
+	}
+}
@@ -0,0 +1,280 @@
+package jsonrpc2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/rpc"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Side is a side of RPC call reported to Metrics.
+type Side string
+
+// Sides of RPC call.
+const (
+	ClientSide Side = "client"
+	ServerSide Side = "server"
+)
+
+// Metrics is an interface for collecting metrics of client and server.
+//
+// Calls which failed before method name was known (e.g. because of parse
+// error) are reported with empty method. Server reports calls to methods
+// which aren't registered with method "unknown", so clients can't add
+// arbitrary labels. Methods are called
+// synchronously and must not block.
+type Metrics interface {
+	// CallStarted is called when request is sent by client or received
+	// by server.
+	CallStarted(side Side, method string)
+	// CallFinished is called when response is received by client or
+	// sent by server (or call has failed). Code is 0 on success or
+	// code of *Error.
+	CallFinished(side Side, method string, code int, duration time.Duration)
+	// BatchSize is called by server for each received batch request.
+	BatchSize(n int)
+	// HTTPStatus is called for each HTTP response sent by server or
+	// received by client.
+	HTTPStatus(side Side, status int)
+}
+
+// unknownMethod is reported by server instead of method which isn't
+// registered.
+const unknownMethod = "unknown"
+
+//nolint:gochecknoglobals // Constant.
+var (
+	durationBuckets  = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	batchSizeBuckets = []float64{1, 2, 5, 10, 20, 50, 100}
+)
+
+var (
+	knownMethods sync.Map //nolint:gochecknoglobals // handlerKey -> struct{}
+	errProbe     = errors.New("probe")
+)
+
+// metricMethod returns method if it's registered in srv or unknownMethod
+// otherwise.
+func metricMethod(srv *rpc.Server, method string) string {
+	key := handlerKey{srv, method}
+	if _, ok := knownMethods.Load(key); ok {
+		return method
+	}
+	probe := methodProbe{method: handlerMethodName(srv, method)}
+	_ = srv.ServeRequest(&probe)
+	if !probe.found {
+		return unknownMethod
+	}
+	knownMethods.Store(key, struct{}{})
+	return method
+}
+
+// methodProbe is a rpc.ServerCodec which finds out is method registered
+// without calling it: rpc.Server reads request body into nil only if
+// method wasn't found.
+type methodProbe struct {
+	method string
+	found  bool
+}
+
+func (p *methodProbe) ReadRequestHeader(r *rpc.Request) error {
+	r.ServiceMethod = p.method
+	return nil
+}
+
+func (p *methodProbe) ReadRequestBody(x interface{}) error {
+	p.found = x != nil
+	return errProbe
+}
+
+func (*methodProbe) WriteResponse(*rpc.Response, interface{}) error { return nil }
+
+func (*methodProbe) Close() error { return nil }
+
+// PrometheusMetrics is a Metrics which exposes collected metrics in
+// Prometheus text format using ServeHTTP.
+type PrometheusMetrics struct {
+	mu        sync.Mutex
+	calls     map[callLabels]uint64
+	inFlight  map[methodLabels]int64
+	durations map[methodLabels]*histogram
+	batches   histogram
+	statuses  map[statusLabels]uint64
+}
+
+type methodLabels struct {
+	side   Side
+	method string
+}
+
+type callLabels struct {
+	side   Side
+	method string
+	code   int
+}
+
+type statusLabels struct {
+	side   Side
+	status int
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	for i, le := range buckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// NewPrometheusMetrics returns new PrometheusMetrics.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		calls:     make(map[callLabels]uint64),
+		inFlight:  make(map[methodLabels]int64),
+		durations: make(map[methodLabels]*histogram),
+		statuses:  make(map[statusLabels]uint64),
+	}
+}
+
+// CallStarted implements Metrics.
+func (m *PrometheusMetrics) CallStarted(side Side, method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[methodLabels{side, method}]++
+}
+
+// CallFinished implements Metrics.
+func (m *PrometheusMetrics) CallFinished(side Side, method string, code int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := methodLabels{side, method}
+	m.inFlight[l]--
+	m.calls[callLabels{side, method, code}]++
+	h := m.durations[l]
+	if h == nil {
+		h = &histogram{}
+		m.durations[l] = h
+	}
+	h.observe(durationBuckets, duration.Seconds())
+}
+
+// BatchSize implements Metrics.
+func (m *PrometheusMetrics) BatchSize(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches.observe(batchSizeBuckets, float64(n))
+}
+
+// HTTPStatus implements Metrics.
+func (m *PrometheusMetrics) HTTPStatus(side Side, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses[statusLabels{side, status}]++
+}
+
+// ServeHTTP writes all metrics in Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(m.String()))
+}
+
+// String returns all metrics in Prometheus text format.
+func (m *PrometheusMetrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var lines []string
+	var buf strings.Builder
+
+	buf.WriteString("# HELP jsonrpc2_calls_total Total number of finished calls.\n")
+	buf.WriteString("# TYPE jsonrpc2_calls_total counter\n")
+	for l, v := range m.calls {
+		lines = append(lines, fmt.Sprintf("jsonrpc2_calls_total{side=%q,method=%s,code=\"%d\"} %d\n",
+			l.side, quoteLabel(l.method), l.code, v))
+	}
+	writeSorted(&buf, &lines)
+
+	buf.WriteString("# HELP jsonrpc2_calls_in_flight Number of calls in progress.\n")
+	buf.WriteString("# TYPE jsonrpc2_calls_in_flight gauge\n")
+	for l, v := range m.inFlight {
+		lines = append(lines, fmt.Sprintf("jsonrpc2_calls_in_flight{side=%q,method=%s} %d\n",
+			l.side, quoteLabel(l.method), v))
+	}
+	writeSorted(&buf, &lines)
+
+	buf.WriteString("# HELP jsonrpc2_call_duration_seconds Duration of finished calls.\n")
+	buf.WriteString("# TYPE jsonrpc2_call_duration_seconds histogram\n")
+	for l, h := range m.durations {
+		labels := fmt.Sprintf("side=%q,method=%s", l.side, quoteLabel(l.method))
+		lines = append(lines, formatHistogram("jsonrpc2_call_duration_seconds", labels, durationBuckets, h))
+	}
+	writeSorted(&buf, &lines)
+
+	buf.WriteString("# HELP jsonrpc2_batch_size Number of requests in received batches.\n")
+	buf.WriteString("# TYPE jsonrpc2_batch_size histogram\n")
+	buf.WriteString(formatHistogram("jsonrpc2_batch_size", "", batchSizeBuckets, &m.batches))
+
+	buf.WriteString("# HELP jsonrpc2_http_responses_total Total number of HTTP responses.\n")
+	buf.WriteString("# TYPE jsonrpc2_http_responses_total counter\n")
+	for l, v := range m.statuses {
+		lines = append(lines, fmt.Sprintf("jsonrpc2_http_responses_total{side=%q,status=\"%d\"} %d\n",
+			l.side, l.status, v))
+	}
+	writeSorted(&buf, &lines)
+
+	return buf.String()
+}
+
+func writeSorted(buf *strings.Builder, lines *[]string) {
+	sort.Strings(*lines)
+	for _, line := range *lines {
+		buf.WriteString(line)
+	}
+	*lines = (*lines)[:0]
+}
+
+func formatHistogram(name, labels string, buckets []float64, h *histogram) string {
+	var buf strings.Builder
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, le := range buckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(&buf, "%s_bucket{%s%sle=\"%s\"} %d\n",
+			name, labels, sep, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(&buf, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(&buf, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(&buf, "%s_count%s %d\n", name, labels, h.count)
+	return buf.String()
+}
+
+// quoteLabel returns label value quoted according to Prometheus text
+// format.
+func quoteLabel(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
@@ -0,0 +1,83 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := jsonrpc2.NewPrometheusMetrics()
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(nil, jsonrpc2.WithMetrics(m)))
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL, jsonrpc2.WithMetrics(m))
+	defer client.Close()
+
+	client.Call("Svc.Sum", [2]int{3, 5}, new(int))
+	client.Call("Svc.Missing", nil, nil)
+	client.Call("Random.Name", nil, nil)
+	client.Notify("Svc.Sum", [2]int{3, 5})
+	req, err := http.NewRequest("POST", ts.URL, strings.NewReader(
+		`[{"jsonrpc":"2.0","id":1,"method":"Svc.Sum","params":[1,2]},{"jsonrpc":"2.0","id":2,"method":"Svc.Sum","params":[1,2]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if strings.Contains(m.String(), `{side="client",status="204"}`) {
+			break
+		}
+	}
+
+	scrape := httptest.NewServer(m)
+	defer scrape.Close()
+	resp, err = http.Get(scrape.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf)
+
+	for _, want := range []string{
+		"# TYPE jsonrpc2_calls_total counter\n",
+		`jsonrpc2_calls_total{side="client",method="Svc.Missing",code="-32601"} 1` + "\n",
+		`jsonrpc2_calls_total{side="client",method="Svc.Sum",code="0"} 2` + "\n",
+		`jsonrpc2_calls_total{side="server",method="unknown",code="-32601"} 2` + "\n",
+		`jsonrpc2_calls_in_flight{side="server",method="unknown"} 0` + "\n",
+		`jsonrpc2_calls_total{side="server",method="Svc.Sum",code="0"} 4` + "\n",
+		`jsonrpc2_calls_in_flight{side="client",method="Svc.Sum"} 0` + "\n",
+		`jsonrpc2_call_duration_seconds_count{side="server",method="Svc.Sum"} 4` + "\n",
+		`jsonrpc2_call_duration_seconds_bucket{side="server",method="Svc.Sum",le="+Inf"} 4` + "\n",
+		`jsonrpc2_batch_size_bucket{le="2"} 1` + "\n",
+		`jsonrpc2_batch_size_count 1` + "\n",
+		`jsonrpc2_http_responses_total{side="client",status="200"} 3` + "\n",
+		`jsonrpc2_http_responses_total{side="client",status="204"} 1` + "\n",
+		`jsonrpc2_http_responses_total{side="server",status="200"} 4` + "\n",
+		`jsonrpc2_http_responses_total{side="server",status="204"} 1` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	for _, label := range []string{`side="server",method="Svc.Missing"`, `side="server",method="Random.Name"`} {
+		if strings.Contains(got, label) {
+			t.Errorf("unexpected %q in:\n%s", label, got)
+		}
+	}
+}
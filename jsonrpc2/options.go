@@ -0,0 +1,316 @@
+package jsonrpc2
+
+import "time"
+
+const (
+	defaultMaxInFlight  = 16
+	defaultResolveEvery = 30 * time.Second
+)
+
+// Option is a configuration option for client or server.
+//
+// Each option documents where it is supported, everywhere else it is
+// ignored.
+type Option func(*options)
+
+type options struct {
+	maxInFlight   int
+	backoff       *Backoff
+	requeue       bool
+	connStateHook func(ConnState, error)
+	poolSize      int
+	balancer      Balancer
+	resolveEvery  time.Duration
+	retry         *RetryPolicy
+	breaker       *BreakerPolicy
+	hedge         *HedgePolicy
+	genID         IDGenerator
+	logger        Logger
+	accessLog     bool
+	metrics       Metrics
+	tracer        Tracer
+	metaMember    string
+	maxMsgSize    int64
+	maxDepth      int
+	maxBatchLen   int
+	maxConcurrent int
+
+	batchParallelism int
+	batchTimeout     time.Duration
+
+	authenticator Authenticator
+	policy        *Policy
+	rateLimits    []*rateLimiter
+
+	shutdownNotify string
+
+	idleTimeout  time.Duration
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	callTimeouts []CallTimeout
+
+	propagateDeadline bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logger == nil {
+		o.logger = stdLogger{}
+	}
+	return o
+}
+
+// WithMaxInFlight limits amount of concurrent HTTP requests sent by HTTP
+// client (16 by default). Use WithMaxConcurrentRequests to limit
+// server codec.
+func WithMaxInFlight(n int) Option {
+	return func(o *options) { o.maxInFlight = n }
+}
+
+// WithBackoff sets delays between reconnection attempts used by client
+// created with DialReconnecting.
+//
+// Default is Backoff{Jitter: 0.2}.
+func WithBackoff(b Backoff) Option {
+	return func(o *options) { o.backoff = &b }
+}
+
+// WithRequeue makes client created with DialReconnecting re-send calls
+// pending on disconnect (and send calls made while disconnected) after
+// reconnection instead of failing them.
+//
+// Use it only if all called methods are idempotent, because server
+// may have already processed some of these calls before disconnect.
+func WithRequeue() Option {
+	return func(o *options) { o.requeue = true }
+}
+
+// WithConnStateHook sets hook which will be called by client created with
+// DialReconnecting on each change of connection's state. If change was
+// caused by an error then it will be provided in err.
+//
+// Hook is called synchronously, it must not block.
+func WithConnStateHook(hook func(state ConnState, err error)) Option {
+	return func(o *options) { o.connStateHook = hook }
+}
+
+// WithPoolSize sets amount of connections opened by Pool to each
+// endpoint (1 by default).
+func WithPoolSize(n int) Option {
+	return func(o *options) { o.poolSize = n }
+}
+
+// WithBalancer sets Pool's load balancing policy (RoundRobin by default).
+func WithBalancer(b Balancer) Option {
+	return func(o *options) { o.balancer = b }
+}
+
+// WithResolveInterval sets how often Pool will refresh endpoints using
+// Resolver and replace broken connections (30s by default).
+func WithResolveInterval(d time.Duration) Option {
+	return func(o *options) { o.resolveEvery = d }
+}
+
+// WithRetry makes Client and Pool retry failed calls according to policy.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) { o.retry = &policy }
+}
+
+// WithBreaker adds circuit breaker to Client. When used with Pool each
+// connection will have own circuit breaker and Pool will avoid
+// connections with open circuit.
+func WithBreaker(policy BreakerPolicy) Option {
+	return func(o *options) { o.breaker = &policy }
+}
+
+// WithHedging makes Pool send duplicate call to another connection when
+// call takes too long according to policy.
+func WithHedging(policy HedgePolicy) Option {
+	return func(o *options) { o.hedge = &policy }
+}
+
+// WithIDGenerator sets generator of request IDs used by client
+// (SeqID by default).
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(o *options) { o.genID = gen }
+}
+
+// WithLogger sets logger used by client, Pool, server codec or HTTP
+// handler.
+//
+// By default errors are logged using standard log package and all other
+// levels are ignored.
+func WithLogger(l Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithAccessLog makes server codec or HTTP handler log each call at
+// Info level with method, id, duration and error code.
+func WithAccessLog() Option {
+	return func(o *options) { o.accessLog = true }
+}
+
+// WithMetrics sets metrics collector used by client, server codec or
+// HTTP handler.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) { o.metrics = m }
+}
+
+// WithTracer sets tracer used by client, server codec or HTTP handler to
+// start span for each call.
+//
+// Trace context is propagated even without tracer: client sends span
+// context from call's context (see ContextWithSpanContext) and server
+// provides received span context in request context.
+func WithTracer(t Tracer) Option {
+	return func(o *options) { o.tracer = t }
+}
+
+// WithMetaMember makes client send trace context and metadata (see
+// ContextWithMetadata) in reserved request member with given name (e.g.
+// "_meta") and server codec accept it. It's useful for transports other
+// than HTTP, which uses headers. Both client and server must use same
+// name. Without this option server codec rejects requests with unknown
+// members.
+//
+// Member value is an object with string values, e.g.
+// {"traceparent":"00-…-…-01","tenant":"acme"}.
+func WithMetaMember(name string) Option {
+	return func(o *options) { o.metaMember = name }
+}
+
+// WithMaxMessageSize limits size of each message received by server codec
+// or HTTP handler (unlimited by default). On larger message server will
+// reply with parse error and close connection.
+func WithMaxMessageSize(n int64) Option {
+	return func(o *options) { o.maxMsgSize = n }
+}
+
+// WithMaxDepth limits nesting depth of arrays and objects (including
+// batch array) in each message received by server codec or HTTP handler
+// (unlimited by default). On deeper message server will reply with
+// invalid request error and close connection.
+func WithMaxDepth(n int) Option {
+	return func(o *options) { o.maxDepth = n }
+}
+
+// WithMaxBatchLen limits amount of requests in batch received by server
+// codec or HTTP handler (unlimited by default). On larger batch server
+// will reply with invalid request error.
+func WithMaxBatchLen(n int) Option {
+	return func(o *options) { o.maxBatchLen = n }
+}
+
+// WithMaxConcurrentRequests limits amount of concurrent requests
+// processed by server codec per connection (unlimited by default). Server
+// codec won't read next request from connection until one of processing
+// requests will be completed.
+func WithMaxConcurrentRequests(n int) Option {
+	return func(o *options) { o.maxConcurrent = n }
+}
+
+// WithBatchParallelism limits amount of requests from same batch
+// processed concurrently by server codec or HTTP handler (unlimited by
+// default).
+func WithBatchParallelism(n int) Option {
+	return func(o *options) { o.batchParallelism = n }
+}
+
+// WithSequentialBatch makes server codec or HTTP handler process requests
+// from batch one by one in same order as they are listed in batch.
+// It's same as WithBatchParallelism(1).
+func WithSequentialBatch() Option {
+	return WithBatchParallelism(1)
+}
+
+// WithBatchTimeout limits time used by server codec or HTTP handler to
+// process batch. Requests which wasn't completed in time will get error
+// response with code -32000, but will continue running in background.
+// Context of batch requests will be canceled after timeout.
+func WithBatchTimeout(d time.Duration) Option {
+	return func(o *options) { o.batchTimeout = d }
+}
+
+// WithAuthenticator makes server codec or HTTP handler authenticate
+// clients using auth. Principal of authenticated client is available in
+// request context using PrincipalFromContext.
+//
+// HTTP handler replies with HTTP status 401 to unauthenticated requests.
+// Server codec replies with error to all calls until client will be
+// authenticated using TLS identity or AuthenticateMethod call.
+func WithAuthenticator(auth Authenticator) Option {
+	return func(o *options) { o.authenticator = auth }
+}
+
+// WithPolicy makes server codec or HTTP handler check each call
+// (including calls in batch) using policy before processing it.
+func WithPolicy(policy Policy) Option {
+	return func(o *options) { o.policy = &policy }
+}
+
+// WithRateLimit makes server codec or HTTP handler reject calls which
+// exceed limit. It may be used many times to add more limits.
+//
+// All server codecs and HTTP handlers created with same Option returned
+// by WithRateLimit share same limits.
+//
+// HTTP handler replies with HTTP status 429 and Retry-After header to
+// limited requests which are not a part of batch request.
+func WithRateLimit(limit RateLimit) Option {
+	l := newRateLimiter(limit)
+	return func(o *options) { o.rateLimits = append(o.rateLimits, l) }
+}
+
+// WithShutdownNotification makes Server send notification with given
+// method and without params to each connection when Shutdown is called.
+// Client ignores such notifications.
+func WithShutdownNotification(method string) Option {
+	return func(o *options) { o.shutdownNotify = method }
+}
+
+// WithIdleTimeout makes client or server codec close connection if it
+// doesn't receive next message in time while there are no calls in
+// progress. It's supported only for connections with deadlines (like
+// net.Conn).
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.idleTimeout = d }
+}
+
+// WithReadTimeout makes client or server codec close connection if it
+// doesn't receive whole message in time after receiving it's first
+// bytes. It's supported only for connections with deadlines (like
+// net.Conn).
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) { o.readTimeout = d }
+}
+
+// WithWriteTimeout makes client or server codec close connection if it
+// doesn't send message in time. It's supported only for connections with
+// deadlines (like net.Conn).
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) { o.writeTimeout = d }
+}
+
+// WithCallTimeout makes server codec or HTTP handler limit time used to
+// process calls: request context will have a deadline and client will
+// get timeout error without waiting until method returns, it's result
+// will be dropped. It may be used many times to override timeout for
+// some methods, last added matching timeout is used.
+func WithCallTimeout(timeout CallTimeout) Option {
+	return func(o *options) { o.callTimeouts = append(o.callTimeouts, timeout) }
+}
+
+// WithDeadlinePropagation makes client send remaining time until call's
+// context deadline to server and makes server codec or HTTP handler use
+// it as a deadline for request context.
+//
+// HTTP transport sends it in X-Request-Timeout header in grpc-timeout
+// format (e.g. "1500m"), other transports send it in "timeout" member of
+// object with metadata (so WithMetaMember must be used on both sides).
+func WithDeadlinePropagation() Option {
+	return func(o *options) { o.propagateDeadline = true }
+}
@@ -0,0 +1,362 @@
+package jsonrpc2
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver is an interface for getting addresses of Pool's endpoints.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]string, error)
+}
+
+// StaticResolver is a Resolver which returns fixed list of addresses.
+type StaticResolver []string
+
+// Resolve implements Resolver.
+func (r StaticResolver) Resolve(context.Context) ([]string, error) {
+	return r, nil
+}
+
+// FileResolver is a Resolver which reads addresses from a file with
+// given name on each Resolve. File should contain one address per line,
+// empty lines and lines beginning with '#' are ignored.
+type FileResolver string
+
+// Resolve implements Resolver.
+func (r FileResolver) Resolve(context.Context) ([]string, error) {
+	f, err := os.Open(string(r))
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && line[0] != '#' {
+			addrs = append(addrs, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return addrs, f.Close()
+}
+
+// Balancer is a load balancing policy used by Pool.
+type Balancer int
+
+// Load balancing policies.
+const (
+	RoundRobin   Balancer = iota // Use connections in turn.
+	LeastPending                 // Use connection with less pending calls.
+)
+
+// pendingCounter should be implemented by codecs which are able to report
+// amount of pending calls.
+type pendingCounter interface {
+	pendingCount() int
+}
+
+// Pool is a JSON RPC 2.0 client which holds connections to one or more
+// endpoints and balance calls between them.
+//
+// Connections which failed are evicted from Pool and replaced with new
+// ones on next refresh (see WithResolveInterval).
+type Pool struct {
+	network  string
+	resolver Resolver
+	o        *options
+	memberO  *options        // o without retry policy, used by members
+	ctx      context.Context // canceled by Close
+	cancel   context.CancelFunc
+	refreshc chan struct{}
+	wg       sync.WaitGroup
+	latency  latencies
+
+	mu      sync.Mutex // protects members, next, closed
+	members []*poolMember
+	next    int
+	closed  bool
+}
+
+type poolMember struct {
+	addr   string
+	client *Client
+}
+
+func (m *poolMember) pending() int {
+	if c, ok := m.client.codec.(pendingCounter); ok {
+		return c.pendingCount()
+	}
+	return 0
+}
+
+// NewPool connects to JSON-RPC 2.0 servers at the network addresses
+// returned by resolver.
+//
+// Pool is configured by options WithPoolSize, WithBalancer,
+// WithResolveInterval and WithHedging, WithRetry is applied to calls made
+// using Pool, all other options are used to create clients for each
+// connection.
+//
+// It returns error if it fails to connect to any endpoint.
+func NewPool(network string, resolver Resolver, opts ...Option) (*Pool, error) {
+	p := &Pool{
+		network:  network,
+		resolver: resolver,
+		o:        newOptions(opts),
+		refreshc: make(chan struct{}, 1),
+	}
+	memberO := *p.o
+	memberO.retry = nil
+	p.memberO = &memberO
+	if p.o.poolSize <= 0 {
+		p.o.poolSize = 1
+	}
+	if p.o.resolveEvery <= 0 {
+		p.o.resolveEvery = defaultResolveEvery
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	err := p.refresh()
+	p.mu.Lock()
+	n := len(p.members)
+	p.mu.Unlock()
+	if n == 0 {
+		p.cancel()
+		if err == nil {
+			err = errors.New("no endpoints")
+		}
+		return nil, err
+	}
+
+	p.wg.Add(1)
+	go p.refresher()
+	return p, nil
+}
+
+func (p *Pool) refresher() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.o.resolveEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.refreshc:
+		}
+		if err := p.refresh(); err != nil && p.ctx.Err() == nil {
+			p.o.logger.Warn("pool refresh failed", "err", err)
+		}
+	}
+}
+
+// refresh closes connections which are broken or to endpoints which are
+// no longer returned by resolver and opens missing connections.
+func (p *Pool) refresh() error {
+	addrs, err := p.resolver.Resolve(p.ctx)
+	if err != nil {
+		return err
+	}
+	want := make(map[string]int, len(addrs))
+	for _, addr := range addrs {
+		want[addr] = p.o.poolSize
+	}
+
+	p.mu.Lock()
+	var keep []*poolMember
+	var drop []*Client
+	for _, m := range p.members {
+		if want[m.addr] > 0 && m.client.State() != StateClosed {
+			want[m.addr]--
+			keep = append(keep, m)
+		} else {
+			drop = append(drop, m.client)
+		}
+	}
+	p.members = keep
+	p.mu.Unlock()
+	for _, client := range drop {
+		_ = client.Close()
+	}
+
+	dialer := &net.Dialer{}
+	for _, addr := range addrs {
+		for ; want[addr] > 0; want[addr]-- {
+			conn, err2 := dialer.DialContext(p.ctx, p.network, addr)
+			if err2 != nil {
+				err = err2
+				break
+			}
+			client := newClient(newClientCodec(conn, p.memberO), p.memberO)
+			m := &poolMember{addr: addr, client: client}
+			p.mu.Lock()
+			if p.closed {
+				p.mu.Unlock()
+				_ = m.client.Close()
+				return rpc.ErrShutdown
+			}
+			p.members = append(p.members, m)
+			p.mu.Unlock()
+		}
+	}
+	return err
+}
+
+// pick returns connected member other than exclude according to
+// balancing policy, avoiding members with open circuit for method.
+func (p *Pool) pick(method string, exclude *poolMember) (*poolMember, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, rpc.ErrShutdown
+	}
+	var best *poolMember
+	start := p.next
+	for i := 0; i < len(p.members); i++ {
+		n := (start + i) % len(p.members)
+		m := p.members[n]
+		if m == exclude || m.client.State() != StateConnected {
+			continue
+		}
+		if method != "" && m.client.breaker != nil && m.client.breaker.isOpen(method) {
+			continue
+		}
+		if best == nil {
+			best = m
+			p.next = n + 1
+			if p.o.balancer == RoundRobin {
+				break
+			}
+		} else if m.pending() < best.pending() {
+			best = m
+		}
+	}
+	if best == nil {
+		p.triggerRefresh()
+		return nil, errNotConnected
+	}
+	return best, nil
+}
+
+func (p *Pool) triggerRefresh() {
+	select {
+	case p.refreshc <- struct{}{}:
+	default:
+	}
+}
+
+// check refreshes Pool if call failed because of broken connection.
+func (p *Pool) check(err error) {
+	if err == rpc.ErrShutdown || err == errNotConnected {
+		p.triggerRefresh()
+	}
+}
+
+// Call invokes the named function on one of endpoints, waits for it to
+// complete, and returns its error status. Failed call will be retried
+// (probably on another endpoint) according to WithRetry.
+func (p *Pool) Call(serviceMethod string, args, reply interface{}) error {
+	return p.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext is like Call but it stops waiting for the call when ctx is
+// done. See Client.CallContext for details.
+func (p *Pool) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if p.o.retry == nil {
+		return p.callContext(ctx, serviceMethod, args, reply)
+	}
+	return p.o.retry.do(ctx, serviceMethod, func() error {
+		return p.callContext(ctx, serviceMethod, args, reply)
+	}, func() bool {
+		return p.ctx.Err() != nil
+	})
+}
+
+func (p *Pool) callContext(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if p.o.hedge != nil && matchMethod(p.o.hedge.Methods, serviceMethod) {
+		return p.hedgedCall(ctx, serviceMethod, args, reply)
+	}
+	m, err := p.pick(serviceMethod, nil)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = m.client.CallContext(ctx, serviceMethod, args, reply)
+	p.check(err)
+	if err == nil && p.o.hedge != nil {
+		p.latency.add(time.Since(start))
+	}
+	return err
+}
+
+// Go invokes the function asynchronously on one of endpoints.
+// See rpc.Client.Go for details.
+func (p *Pool) Go(serviceMethod string, args, reply interface{}, done chan *rpc.Call) *rpc.Call {
+	if done != nil && cap(done) == 0 {
+		panic("jsonrpc2: done channel is unbuffered")
+	}
+	m, err := p.pick("", nil)
+	if err != nil {
+		if done == nil {
+			done = make(chan *rpc.Call, 1)
+		}
+		call := &rpc.Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Error: err, Done: done}
+		select {
+		case done <- call:
+		default:
+			p.o.logger.Debug("discarding call reply due to insufficient done channel capacity")
+		}
+		return call
+	}
+	return m.client.Go(serviceMethod, args, reply, done)
+}
+
+// Notify try to invoke the named function on one of endpoints. It return
+// error only in case it wasn't able to send request.
+func (p *Pool) Notify(serviceMethod string, args interface{}) error {
+	m, err := p.pick("", nil)
+	if err != nil {
+		return err
+	}
+	err = m.client.Notify(serviceMethod, args)
+	p.check(err)
+	return err
+}
+
+// Len returns amount of connections in Pool.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.members)
+}
+
+// Close closes all connections.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return rpc.ErrShutdown
+	}
+	p.closed = true
+	members := p.members
+	p.members = nil
+	p.mu.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+	for _, m := range members {
+		_ = m.client.Close()
+	}
+	return nil
+}
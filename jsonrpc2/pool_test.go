@@ -0,0 +1,248 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// PoolSvc is an RPC service for testing.
+type PoolSvc struct {
+	id    int
+	block chan struct{}
+}
+
+func (s *PoolSvc) ID(_ struct{}, res *int) error {
+	*res = s.id
+	return nil
+}
+
+func (s *PoolSvc) Block(_ struct{}, res *int) error {
+	<-s.block
+	*res = s.id
+	return nil
+}
+
+type poolServer struct {
+	ln    net.Listener
+	svc   *PoolSvc
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newPoolServer(t *testing.T, id int) *poolServer {
+	t.Helper()
+	s := &poolServer{svc: &PoolSvc{id: id, block: make(chan struct{})}}
+	srv := rpc.NewServer()
+	if err := srv.Register(s.svc); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	s.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := s.ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv))
+		}
+	}()
+	return s
+}
+
+func (s *poolServer) addr() string { return s.ln.Addr().String() }
+
+func (s *poolServer) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *poolServer) Close() {
+	s.ln.Close()
+	s.dropConns()
+}
+
+func poolIDs(t *testing.T, pool *jsonrpc2.Pool, n int) []int {
+	t.Helper()
+	ids := make([]int, n)
+	for i := range ids {
+		if err := pool.Call("PoolSvc.ID", struct{}{}, &ids[i]); err != nil {
+			t.Errorf("Call(), err = %v", err)
+		}
+	}
+	return ids
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	s1, s2 := newPoolServer(t, 1), newPoolServer(t, 2)
+	defer s1.Close()
+	defer s2.Close()
+
+	pool, err := jsonrpc2.NewPool("tcp", jsonrpc2.StaticResolver{s1.addr(), s2.addr()},
+		jsonrpc2.WithPoolSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	if pool.Len() != 4 {
+		t.Errorf("Len() = %d, want = 4", pool.Len())
+	}
+	if got, want := poolIDs(t, pool, 4), []int{1, 1, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ids = %v, want = %v", got, want)
+	}
+}
+
+func TestPoolLeastPending(t *testing.T) {
+	s1, s2 := newPoolServer(t, 1), newPoolServer(t, 2)
+	defer s1.Close()
+	defer s2.Close()
+
+	pool, err := jsonrpc2.NewPool("tcp", jsonrpc2.StaticResolver{s1.addr(), s2.addr()},
+		jsonrpc2.WithBalancer(jsonrpc2.LeastPending))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	call := pool.Go("PoolSvc.Block", struct{}{}, new(int), nil)
+	if got, want := poolIDs(t, pool, 3), []int{2, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ids = %v, want = %v", got, want)
+	}
+	close(s1.svc.block)
+	if call = <-call.Done; call.Error != nil || *call.Reply.(*int) != 1 {
+		t.Errorf("Go() = %v, %v", *call.Reply.(*int), call.Error)
+	}
+}
+
+func TestPoolEvict(t *testing.T) {
+	s1, s2 := newPoolServer(t, 1), newPoolServer(t, 2)
+	defer s1.Close()
+	defer s2.Close()
+
+	pool, err := jsonrpc2.NewPool("tcp", jsonrpc2.StaticResolver{s1.addr(), s2.addr()},
+		jsonrpc2.WithResolveInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	s1.dropConns()
+	time.Sleep(50 * time.Millisecond)
+	if got, want := poolIDs(t, pool, 3), []int{2, 2, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ids = %v, want = %v", got, want)
+	}
+
+	s2.dropConns()
+	time.Sleep(50 * time.Millisecond)
+	if err := pool.Call("PoolSvc.ID", struct{}{}, new(int)); err == nil {
+		t.Errorf("Call() without connections, err = nil")
+	}
+	full := make(chan *rpc.Call, 1)
+	full <- nil
+	if call := pool.Go("PoolSvc.ID", struct{}{}, new(int), full); call.Error == nil {
+		t.Errorf("Go() without connections, err = nil")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Go() with unbuffered done channel didn't panic")
+			}
+		}()
+		pool.Go("PoolSvc.ID", struct{}{}, new(int), make(chan *rpc.Call))
+	}()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if pool.Call("PoolSvc.ID", struct{}{}, new(int)) == nil && pool.Len() == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pool.Len() != 2 {
+		t.Errorf("Len() = %d, want = 2", pool.Len())
+	}
+	ids := poolIDs(t, pool, 2)
+	if ids[0]+ids[1] != 3 {
+		t.Errorf("ids = %v, want both endpoints", ids)
+	}
+}
+
+func TestPoolFileResolver(t *testing.T) {
+	s1 := newPoolServer(t, 1)
+	defer s1.Close()
+
+	f, err := ioutil.TempFile("", "endpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# endpoints\n\n  " + s1.addr() + "  \n")
+	f.Close()
+
+	addrs, err := jsonrpc2.FileResolver(f.Name()).Resolve(nil)
+	if want := []string{s1.addr()}; err != nil || !reflect.DeepEqual(addrs, want) {
+		t.Errorf("Resolve() = %v, %v, want = %v", addrs, err, want)
+	}
+
+	pool, err := jsonrpc2.NewPool("tcp", jsonrpc2.FileResolver(f.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	if got, want := poolIDs(t, pool, 1), []int{1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ids = %v, want = %v", got, want)
+	}
+
+	_, err = jsonrpc2.NewPool("tcp", jsonrpc2.FileResolver(f.Name()+".nonexistent"))
+	if err == nil {
+		t.Errorf("NewPool(nonexistent file), err = nil")
+	}
+}
+
+func TestPoolHedging(t *testing.T) {
+	s1, s2 := newPoolServer(t, 1), newPoolServer(t, 2)
+	defer s1.Close()
+	defer s2.Close()
+	defer close(s1.svc.block)
+	close(s2.svc.block)
+
+	pool, err := jsonrpc2.NewPool("tcp", jsonrpc2.StaticResolver{s1.addr(), s2.addr()},
+		jsonrpc2.WithHedging(jsonrpc2.HedgePolicy{
+			Delay:   20 * time.Millisecond,
+			Methods: []string{"PoolSvc.Block"},
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		var id int
+		err := pool.Call("PoolSvc.Block", struct{}{}, &id)
+		if err != nil || id != 2 {
+			t.Errorf("Call() = %v, %v, want = 2, nil", id, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("Call() took %v", d)
+		}
+	}
+}
@@ -555,7 +555,7 @@ func TestClientResponse(t *testing.T) {
 		{jerrParse, 0.0, errParse},
 		{`{"jsonrpc":"2.0","id":true, "result":0}`, 0.0, errBadResponseFmt},
 		{`{"jsonrpc":"2.0","id":false,"result":0}`, 0.0, errBadResponseFmt},
-		{`{"jsonrpc":"2.0","id":"0",  "result":0}`, 0.0, errBadResponseFmt},
+		{`{"jsonrpc":"2.0","id":"0",  "result":0}`, 0.0, nil},
 		{`{"jsonrpc":"2.0","id":[0],  "result":0}`, 0.0, errBadResponseFmt},
 		{`{"jsonrpc":"2.0","id":{},   "result":0}`, 0.0, errBadResponseFmt},
 		// Result type
@@ -650,6 +650,34 @@ func TestClientResponse(t *testing.T) {
 	}
 }
 
+func TestClientResponseRaw(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{`{"jsonrpc":"2.0","id":0,"result":{"a": [1, 2]}}`, `{"a": [1, 2]}`},
+		{`{"jsonrpc":"2.0","id":0,"result":"str"}`, `"str"`},
+		{`{"jsonrpc":"2.0","id":0,"result":null}`, `null`},
+	}
+	for _, c := range cases {
+		cli, srv := net.Pipe()
+		defer srv.Close()
+		client := NewClient(cli)
+		defer client.Close()
+
+		go func(in string) {
+			bufio.NewReader(srv).ReadString('\n')
+			srv.Write([]byte(in + "\n"))
+		}(c.in)
+
+		var got json.RawMessage
+		err := client.Call("method", nil, &got)
+		if err != nil || string(got) != c.want {
+			t.Errorf("Call() = %#q, %v, want = %#q, nil", got, err, c.want)
+		}
+	}
+}
+
 // TODO test for rpc.ErrShutdown && io.ErrUnexpectedEOF
 
 func TestClientRequest(t *testing.T) {
@@ -793,6 +821,30 @@ func TestClientRequest(t *testing.T) {
 			}),
 			`{"jsonrpc":"2.0","method":"","params":{"A":0,"B":""},"id":0}`, nil,
 		},
+		{
+			"", json.RawMessage(` {"A": [1, 2]}`),
+			`{"jsonrpc":"2.0","method":"","params":{"A":[1,2]},"id":0}`, nil,
+		},
+		{
+			"", &json.RawMessage{'[', ']'},
+			`{"jsonrpc":"2.0","method":"","params":[],"id":0}`, nil,
+		},
+		{
+			"", json.RawMessage(nil),
+			`{"jsonrpc":"2.0","method":"","id":0}`, nil,
+		},
+		{
+			"", (*json.RawMessage)(nil),
+			`{"jsonrpc":"2.0","method":"","id":0}`, nil,
+		},
+		{
+			"", json.RawMessage(`"str"`),
+			``, NewError(-32603, "unsupported param type: invalid json.RawMessage"),
+		},
+		{
+			"", json.RawMessage(`{"A":`),
+			``, NewError(-32603, "unsupported param type: invalid json.RawMessage"),
+		},
 	}
 
 	for _, c := range cases {
@@ -970,3 +1022,23 @@ func TestClientMassError_json(t *testing.T) {
 		t.Errorf("%serr2 = %v, wanterr2 = %v", caller(), err2, wanterr2)
 	}
 }
+
+func TestClientRequestMeta(t *testing.T) {
+	cases := []struct {
+		req  clientRequest
+		want string
+	}{
+		{clientRequest{Version: "2.0", Method: "Svc.Sum", Params: [2]int{3, 5}, ID: 0},
+			`{"jsonrpc":"2.0","method":"Svc.Sum","params":[3,5],"id":0}`},
+		{clientRequest{Version: "2.0", Method: "Svc.Sum", ID: 1, Meta: json.RawMessage(`{"a":"1"}`), metaMember: "meta"},
+			`{"jsonrpc":"2.0","method":"Svc.Sum","id":1,"meta":{"a":"1"}}`},
+		{clientRequest{Version: "2.0", Method: "Svc.Msg", Params: [1]string{"x"}, Meta: json.RawMessage(`{}`), metaMember: "x\"y"},
+			`{"jsonrpc":"2.0","method":"Svc.Msg","params":["x"],"x\"y":{}}`},
+	}
+	for _, c := range cases {
+		buf, err := json.Marshal(&c.req)
+		if err != nil || string(buf) != c.want {
+			t.Errorf("\nwant: %s\ngot:  %s, %v", c.want, buf, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package jsonrpc2
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const rateSweepInterval = time.Minute
+
+var errRateLimited = NewError(-32029, "rate limit exceeded") //nolint:gochecknoglobals
+
+// RateKey defines how calls are grouped into separate token buckets.
+// Keys may be combined, e.g. RateByIP|RateByMethod.
+type RateKey int
+
+// Rate limit keys.
+const (
+	RateByConn      RateKey = 1 << iota // Connection (or HTTP client's address).
+	RateByIP                            // Client's IP address.
+	RateByPrincipal                     // Name of authenticated client.
+	RateByMethod                        // Called method.
+)
+
+// RateLimit is a token bucket rate limit for calls processed by server.
+type RateLimit struct {
+	// Rate is an amount of calls allowed per second.
+	Rate float64
+	// Burst is a max amount of calls allowed at once (1 by default).
+	Burst int
+	// By defines how calls are grouped, all calls use same bucket
+	// by default.
+	By RateKey
+	// Methods is a list of path.Match patterns like "Svc.*" to limit,
+	// all methods are limited by default.
+	Methods []string
+	// Error is returned for limited calls (code -32029 by default).
+	// Its Data will be set to object with "retry_after" member with
+	// amount of seconds.
+	Error *Error
+}
+
+type rateLimiter struct {
+	RateLimit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = 1
+	}
+	if limit.Error == nil {
+		limit.Error = errRateLimited
+	}
+	return &rateLimiter{
+		RateLimit: limit,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes token from bucket with given key or returns delay until
+// token will be available.
+func (l *rateLimiter) allow(key string, now time.Time) (retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateSweepInterval {
+		l.sweep(now)
+	}
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if l.Rate <= 0 {
+		return rateSweepInterval, false
+	}
+	return time.Duration((1 - b.tokens) / l.Rate * float64(time.Second)), false
+}
+
+// refund returns token taken by allow to bucket with given key.
+func (l *rateLimiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b := l.buckets[key]; b != nil {
+		b.tokens = math.Min(float64(l.Burst), b.tokens+1)
+	}
+}
+
+// sweep removes full buckets.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= float64(l.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitedError returns error for call limited for given duration.
+func (l *rateLimiter) rateLimitedError(retryAfter time.Duration) *Error {
+	err := *l.Error
+	err.Data = map[string]float64{"retry_after": math.Ceil(retryAfter.Seconds()*1000) / 1000}
+	return &err
+}
+
+// rateLimited should be implemented by transports which need to report
+// limited call in other way than JSON-RPC error.
+type rateLimited interface {
+	rateLimited(retryAfter time.Duration)
+}
+
+// connInfo describes connection used to receive request.
+type connInfo struct {
+	id         string
+	remoteAddr string
+}
+
+// lastConnID is used to assign unique id to each served connection.
+var lastConnID uint64 //nolint:gochecknoglobals
+
+// withConnInfo returns ctx with information about conn (unless ctx
+// already has it, e.g. for batch request).
+func withConnInfo(ctx context.Context, conn interface{}) context.Context {
+	if _, ok := ctx.Value(connInfoContextKey).(connInfo); ok {
+		return ctx
+	}
+	var info connInfo
+	if req := HTTPRequestFromContext(ctx); req != nil {
+		info.id, info.remoteAddr = req.RemoteAddr, req.RemoteAddr
+	} else {
+		info.id = strconv.FormatUint(atomic.AddUint64(&lastConnID, 1), 10)
+		if c, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+			info.remoteAddr = c.RemoteAddr().String()
+		}
+	}
+	return context.WithValue(ctx, connInfoContextKey, info)
+}
+
+// rateLimit replies with error and returns errHandled if current
+// request exceeds any of rate limits.
+func (c *serverCodec) rateLimit() error {
+	if len(c.o.rateLimits) == 0 || c.req.Method == batchMethod {
+		return nil
+	}
+	now := time.Now()
+	var taken []*rateLimiter // limits which already gave token to this call
+	for _, l := range c.o.rateLimits {
+		if l.Methods != nil && !matchMethod(l.Methods, c.req.Method) {
+			continue
+		}
+		key := c.rateKey(l.By)
+		if retryAfter, ok := l.allow(key, now); !ok {
+			// Limited call must not use tokens of other limits.
+			for _, t := range taken {
+				t.refund(c.rateKey(t.By))
+			}
+			c.o.logger.Warn("rate limit exceeded", "method", c.req.Method, "key", key)
+			if w, ok := c.c.(rateLimited); ok {
+				w.rateLimited(retryAfter)
+			}
+			c.respond(nil, l.rateLimitedError(retryAfter))
+			return errHandled
+		}
+		taken = append(taken, l)
+	}
+	return nil
+}
+
+func (c *serverCodec) rateKey(by RateKey) string {
+	info, _ := c.ctx.Value(connInfoContextKey).(connInfo)
+	var parts []string
+	if by&RateByConn != 0 {
+		parts = append(parts, info.id)
+	}
+	if by&RateByIP != 0 {
+		ip, _, err := net.SplitHostPort(info.remoteAddr)
+		if err != nil {
+			ip = info.remoteAddr
+		}
+		parts = append(parts, ip)
+	}
+	if by&RateByPrincipal != 0 {
+		name := ""
+		if p := PrincipalFromContext(c.ctx); p != nil {
+			name = p.Name
+		}
+		parts = append(parts, name)
+	}
+	if by&RateByMethod != 0 {
+		parts = append(parts, c.req.Method)
+	}
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,152 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+func TestRateLimitStream(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&AuthSvc{})
+	limit := jsonrpc2.WithRateLimit(jsonrpc2.RateLimit{
+		Rate:    0.001,
+		Burst:   2,
+		By:      jsonrpc2.RateByConn,
+		Methods: []string{"AuthSvc.*"},
+	})
+	dial := func() *jsonrpc2.Client {
+		cli, conn := net.Pipe()
+		go srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv, limit))
+		return jsonrpc2.NewClient(cli)
+	}
+
+	client := dial()
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		rpcerr := jsonrpc2.ServerError(client.Call("AuthSvc.Whoami", nil, nil))
+		if rpcerr == nil || rpcerr.Message != "no principal" {
+			t.Errorf("call %d: err = %v", i, rpcerr)
+		}
+	}
+	rpcerr := jsonrpc2.ServerError(client.Call("AuthSvc.Whoami", nil, nil))
+	if rpcerr == nil || rpcerr.Code != -32029 {
+		t.Fatalf("limited: err = %v", rpcerr)
+	}
+	data, _ := rpcerr.Data.(map[string]interface{})
+	if retryAfter, _ := data["retry_after"].(float64); retryAfter <= 0 {
+		t.Errorf("limited: data = %v", rpcerr.Data)
+	}
+	rpcerr = jsonrpc2.ServerError(client.Call("AuthSvc.Missing", nil, nil))
+	if rpcerr == nil || rpcerr.Code != -32029 {
+		t.Errorf("other method: err = %v", rpcerr)
+	}
+	rpcerr = jsonrpc2.ServerError(client.Call("Other.Method", nil, nil))
+	if rpcerr == nil || rpcerr.Code != -32601 {
+		t.Errorf("not limited method: err = %v", rpcerr)
+	}
+
+	client2 := dial()
+	defer client2.Close()
+	rpcerr = jsonrpc2.ServerError(client2.Call("AuthSvc.Whoami", nil, nil))
+	if rpcerr == nil || rpcerr.Message != "no principal" {
+		t.Errorf("other conn: err = %v", rpcerr)
+	}
+}
+
+func TestRateLimitHTTP(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&AuthSvc{})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv,
+		jsonrpc2.WithAuthenticator(tokenAuth),
+		jsonrpc2.WithRateLimit(jsonrpc2.RateLimit{
+			Rate:  0.001,
+			Burst: 1,
+			By:    jsonrpc2.RateByPrincipal | jsonrpc2.RateByMethod,
+			Error: jsonrpc2.NewError(-32030, "slow down"),
+		})))
+	defer ts.Close()
+
+	post := func(body string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, strings.TrimSpace(string(buf))
+	}
+
+	call := `{"jsonrpc":"2.0","id":1,"method":"AuthSvc.Whoami"}`
+	if resp, body := post(call); resp.StatusCode != http.StatusOK {
+		t.Errorf("first: status = %d, body = %s", resp.StatusCode, body)
+	}
+	resp, body := post(call)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("limited: status = %d, Retry-After = %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if !strings.Contains(body, `"code":-32030`) || !strings.Contains(body, `"retry_after"`) {
+		t.Errorf("limited: body = %s", body)
+	}
+
+	resp, body = post(`[` + call + `,{"jsonrpc":"2.0","id":2,"method":"AuthSvc.Missing"}]`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("batch: status = %d", resp.StatusCode)
+	}
+	if !strings.HasPrefix(body, `[{"jsonrpc":"2.0","id":1,"error":{"code":-32030,`) ||
+		!strings.Contains(body, `{"jsonrpc":"2.0","id":2,"error":{"code":-32601,`) {
+		t.Errorf("batch: body = %s", body)
+	}
+
+	client := jsonrpc2.NewCustomHTTPClient(ts.URL, jsonrpc2.DoerFunc(func(req *http.Request) (*http.Response, error) {
+		req.Header.Set("Authorization", "Bearer secret")
+		return http.DefaultClient.Do(req)
+	}))
+	defer client.Close()
+	rpcerr := jsonrpc2.ServerError(client.Call("AuthSvc.Whoami", nil, nil))
+	if rpcerr == nil || rpcerr.Code != -32030 {
+		t.Errorf("client: err = %v", rpcerr)
+	}
+}
+
+func TestRateLimitRefund(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&AuthSvc{})
+	cli, conn := net.Pipe()
+	go srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv,
+		jsonrpc2.WithRateLimit(jsonrpc2.RateLimit{Rate: 0.001, Burst: 2}),
+		jsonrpc2.WithRateLimit(jsonrpc2.RateLimit{Rate: 0.001, Methods: []string{"AuthSvc.Missing"}}),
+	))
+	client := jsonrpc2.NewClient(cli)
+	defer client.Close()
+
+	rpcerr := jsonrpc2.ServerError(client.Call("AuthSvc.Missing", nil, nil))
+	if rpcerr == nil || rpcerr.Code != -32601 {
+		t.Errorf("first: err = %v", rpcerr)
+	}
+	for i := 0; i < 3; i++ {
+		rpcerr = jsonrpc2.ServerError(client.Call("AuthSvc.Missing", nil, nil))
+		if rpcerr == nil || rpcerr.Code != -32029 {
+			t.Errorf("limited %d: err = %v", i, rpcerr)
+		}
+	}
+	rpcerr = jsonrpc2.ServerError(client.Call("AuthSvc.Whoami", nil, nil))
+	if rpcerr == nil || rpcerr.Message != "no principal" {
+		t.Errorf("other method: err = %v", rpcerr)
+	}
+}
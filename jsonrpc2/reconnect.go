@@ -0,0 +1,349 @@
+package jsonrpc2
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/rpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConnState describes state of client's connection.
+type ConnState int
+
+// Client's connection states.
+const (
+	StateConnected    ConnState = iota // Ready to send calls.
+	StateConnecting                    // Dialing.
+	StateDisconnected                  // Waiting before next reconnection attempt.
+	StateClosed                        // Client was closed or failed.
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateConnecting:
+		return "connecting"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// connStater should be implemented by codecs which are able to report
+// state of their connection.
+type connStater interface {
+	connState() ConnState
+}
+
+// DialReconnecting connects to a JSON-RPC 2.0 server at the specified
+// network address just like Dial, but returned Client will transparently
+// redial (with delays defined by WithBackoff) after connection is lost.
+//
+// Calls pending on disconnect and calls made while disconnected will
+// fail with *Error (code -32603), unless WithRequeue option is used.
+// Use WithConnStateHook option, Client.State or Client.Health to check
+// connection's state.
+func DialReconnecting(network, address string, opts ...Option) (*Client, error) {
+	dialer := &net.Dialer{}
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	o := newOptions(opts)
+	codec, err := newReconnectCodec(dial, o)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(codec, o), nil
+}
+
+type reconnectCodec struct {
+	dial   func(context.Context) (io.ReadWriteCloser, error)
+	opts   *options
+	ctx    context.Context // canceled by Close
+	cancel context.CancelFunc
+	hookMu sync.Mutex // serializes calls to connStateHook
+	wmu    sync.Mutex // serializes writes to codec
+
+	mu      sync.Mutex // protects all fields below
+	cond    *sync.Cond // signaled on changes of codec, state and failed
+	state   ConnState
+	gen     uint64       // incremented on each connect
+	codec   *clientCodec // nil while disconnected
+	pending map[uint64]*reconnectCall
+	failed  []*reconnectCall // calls to be reported as failed
+
+	// used only by ReadResponseHeader/ReadResponseBody
+	rcodec   *clientCodec
+	skipBody bool
+}
+
+// reconnectCall is a call sent or waiting to be sent after reconnect.
+type reconnectCall struct {
+	seq    uint64
+	method string
+	param  interface{}
+	gen    uint64 // generation of connection used to send call, 0 if not sent
+	err    *Error
+}
+
+func newReconnectCodec(dial func(context.Context) (io.ReadWriteCloser, error), opts *options) (*reconnectCodec, error) {
+	c := &reconnectCodec{
+		dial:    dial,
+		opts:    opts,
+		pending: make(map[uint64]*reconnectCall),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.cond = sync.NewCond(&c.mu)
+	conn, err := dial(c.ctx)
+	if err != nil {
+		c.cancel()
+		return nil, err
+	}
+	c.connect(conn)
+	return c, nil
+}
+
+// setState must be called with c.mu held, it'll unlock c.mu.
+func (c *reconnectCodec) setState(state ConnState, err error) {
+	c.state = state
+	c.cond.Broadcast()
+	hook := c.opts.connStateHook
+	if hook != nil {
+		c.hookMu.Lock()
+	}
+	c.mu.Unlock()
+	if hook != nil {
+		hook(state, err)
+		c.hookMu.Unlock()
+	}
+}
+
+// connect starts using conn and re-sends queued calls.
+func (c *reconnectCodec) connect(conn io.ReadWriteCloser) {
+	codec := newClientCodec(conn, c.opts)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		logIfFail(c.opts.logger, conn.Close)
+		return
+	}
+	c.gen++
+	c.codec = codec
+	var queued []*reconnectCall
+	for _, call := range c.pending {
+		if call.gen == 0 {
+			call.gen = c.gen
+			queued = append(queued, call)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].seq < queued[j].seq })
+	c.setState(StateConnected, nil)
+
+	for _, call := range queued {
+		r := &rpc.Request{ServiceMethod: call.method, Seq: call.seq}
+		if err := codec.WriteRequest(r, call.param); err != nil {
+			c.fail(call, err)
+		}
+	}
+}
+
+// fail removes call from pending and reports it as failed.
+func (c *reconnectCodec) fail(call *reconnectCall, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[call.seq] == call {
+		delete(c.pending, call.seq)
+		call.err = NewError(errInternal.Code, err.Error())
+		c.failed = append(c.failed, call)
+		c.cond.Broadcast()
+	}
+}
+
+// disconnected handles failure of connection with given generation.
+func (c *reconnectCodec) disconnected(gen uint64, err error) {
+	c.mu.Lock()
+	if c.gen != gen || c.codec == nil {
+		c.mu.Unlock()
+		return
+	}
+	codec := c.codec
+	c.codec = nil
+	var failed []*reconnectCall
+	for seq, call := range c.pending {
+		switch {
+		case call.gen != gen:
+		case c.opts.requeue:
+			call.gen = 0
+		default:
+			delete(c.pending, seq)
+			call.err = NewError(errInternal.Code, "connection lost: "+err.Error())
+			failed = append(failed, call)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].seq < failed[j].seq })
+	c.failed = append(c.failed, failed...)
+	c.setState(StateDisconnected, err)
+
+	c.opts.logger.Warn("connection lost", "err", err)
+	logIfFail(c.opts.logger, codec.Close)
+	go c.reconnect()
+}
+
+func (c *reconnectCodec) reconnect() {
+	backoff := Backoff{Jitter: 0.2}
+	if c.opts.backoff != nil {
+		backoff = *c.opts.backoff
+	}
+	for attempt := 0; ; attempt++ {
+		timer := time.NewTimer(backoff.Delay(attempt))
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		c.mu.Lock()
+		if c.state == StateClosed {
+			c.mu.Unlock()
+			return
+		}
+		c.setState(StateConnecting, nil)
+
+		conn, err := c.dial(c.ctx)
+		if err == nil {
+			c.connect(conn)
+			return
+		}
+
+		c.mu.Lock()
+		if c.state == StateClosed {
+			c.mu.Unlock()
+			return
+		}
+		c.opts.logger.Warn("reconnect failed", "attempt", attempt+1, "err", err)
+		c.setState(StateDisconnected, err)
+	}
+}
+
+func (c *reconnectCodec) WriteRequest(r *rpc.Request, param interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		return rpc.ErrShutdown
+	}
+	codec := c.codec
+	call := &reconnectCall{seq: r.Seq, method: r.ServiceMethod, param: param, gen: c.gen}
+	if codec == nil {
+		defer c.mu.Unlock()
+		if !c.opts.requeue || r.Seq == seqNotify {
+			return errNotConnected
+		}
+		call.gen = 0
+		c.pending[r.Seq] = call
+		return nil
+	}
+	if r.Seq != seqNotify {
+		c.pending[r.Seq] = call
+	}
+	c.mu.Unlock()
+
+	err := codec.WriteRequest(r, param)
+	if err != nil {
+		c.mu.Lock()
+		if c.pending[r.Seq] == call {
+			delete(c.pending, r.Seq)
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *reconnectCodec) ReadResponseHeader(r *rpc.Response) error {
+	c.skipBody = false
+	for {
+		c.mu.Lock()
+		for c.codec == nil && len(c.failed) == 0 && c.state != StateClosed {
+			c.cond.Wait()
+		}
+		if len(c.failed) > 0 {
+			call := c.failed[0]
+			c.failed[0] = nil
+			c.failed = c.failed[1:]
+			c.mu.Unlock()
+			r.ServiceMethod = call.method
+			r.Seq = call.seq
+			r.Error = call.err.Error()
+			c.skipBody = true
+			return nil
+		}
+		if c.state == StateClosed {
+			c.mu.Unlock()
+			return io.EOF
+		}
+		codec, gen := c.codec, c.gen
+		c.mu.Unlock()
+
+		err := codec.ReadResponseHeader(r)
+		if err == nil {
+			c.mu.Lock()
+			if call := c.pending[r.Seq]; call != nil && call.gen == gen {
+				delete(c.pending, r.Seq)
+			}
+			c.mu.Unlock()
+			c.rcodec = codec
+			return nil
+		}
+		c.disconnected(gen, err)
+	}
+}
+
+func (c *reconnectCodec) ReadResponseBody(x interface{}) error {
+	if c.skipBody {
+		return nil
+	}
+	return c.rcodec.ReadResponseBody(x)
+}
+
+func (c *reconnectCodec) Close() error {
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		return nil
+	}
+	codec := c.codec
+	c.codec = nil
+	c.cancel()
+	c.setState(StateClosed, nil)
+	if codec != nil {
+		return codec.Close()
+	}
+	return nil
+}
+
+// connState implements connStater.
+func (c *reconnectCodec) connState() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// pendingCount implements pendingCounter.
+func (c *reconnectCodec) pendingCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
@@ -0,0 +1,191 @@
+// nolint:errcheck
+package jsonrpc2
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeDialer returns connections served by given funcs, one per dial.
+type pipeDialer struct {
+	mu    sync.Mutex
+	serve []func(net.Conn)
+}
+
+func (d *pipeDialer) dial(ctx context.Context) (io.ReadWriteCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.serve) == 0 {
+		return nil, io.ErrClosedPipe
+	}
+	cli, srv := net.Pipe()
+	go d.serve[0](srv)
+	d.serve = d.serve[1:]
+	return cli, nil
+}
+
+// serveOneAndDrop reads one request and closes conn without reply.
+func serveOneAndDrop(conn net.Conn) {
+	bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+}
+
+func serveJSONRPC2(conn net.Conn) { ServeConn(conn) }
+
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []ConnState
+}
+
+func (r *stateRecorder) hook(state ConnState, _ error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, state)
+}
+
+func (r *stateRecorder) get() []ConnState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ConnState(nil), r.states...)
+}
+
+func waitState(t *testing.T, client *Client, state ConnState) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); client.State() != state && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if got := client.State(); got != state {
+		t.Fatalf("State() = %v, want = %v", got, state)
+	}
+}
+
+func TestReconnectFail(t *testing.T) {
+	d := &pipeDialer{serve: []func(net.Conn){serveOneAndDrop, serveJSONRPC2}}
+	var rec stateRecorder
+	codec, err := newReconnectCodec(d.dial, newOptions([]Option{
+		WithBackoff(Backoff{Min: time.Millisecond}),
+		WithConnStateHook(rec.hook),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientWithCodec(codec)
+	defer client.Close()
+
+	var got int
+	err = client.Call("Svc.Sum", [2]int{3, 5}, &got)
+	if e := ServerError(err); e == nil || e.Code != errInternal.Code {
+		t.Errorf("Call() on dropped conn, err = %v", err)
+	}
+
+	waitState(t, client, StateConnected)
+	if err := client.Health(); err != nil {
+		t.Errorf("Health() = %v", err)
+	}
+	err = client.Call("Svc.Sum", [2]int{3, 5}, &got)
+	if err != nil || got != 8 {
+		t.Errorf("Call() after reconnect = %v, %v", got, err)
+	}
+
+	client.Close()
+	if err := client.Health(); err != rpc.ErrShutdown {
+		t.Errorf("Health() after Close = %v", err)
+	}
+	want := []ConnState{StateConnected, StateDisconnected, StateConnecting, StateConnected, StateClosed}
+	if got := rec.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("states = %v, want = %v", got, want)
+	}
+}
+
+func TestReconnectRequeue(t *testing.T) {
+	d := &pipeDialer{serve: []func(net.Conn){serveOneAndDrop, serveJSONRPC2}}
+	codec, err := newReconnectCodec(d.dial, newOptions([]Option{
+		WithBackoff(Backoff{Min: 10 * time.Millisecond}),
+		WithRequeue(),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientWithCodec(codec)
+	defer client.Close()
+
+	var got int
+	err = client.Call("Svc.Sum", [2]int{3, 5}, &got)
+	if err != nil || got != 8 {
+		t.Errorf("Call() = %v, %v", got, err)
+	}
+}
+
+func TestReconnectNotConnected(t *testing.T) {
+	d := &pipeDialer{serve: []func(net.Conn){serveOneAndDrop}}
+	codec, err := newReconnectCodec(d.dial, newOptions([]Option{
+		WithBackoff(Backoff{Min: time.Hour}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientWithCodec(codec)
+
+	client.Call("Svc.Sum", [2]int{3, 5}, nil)
+	waitState(t, client, StateDisconnected)
+	if err := client.Health(); err != errNotConnected {
+		t.Errorf("Health() = %v, want = %v", err, errNotConnected)
+	}
+	if err := client.Call("Svc.Sum", [2]int{3, 5}, nil); err != errNotConnected {
+		t.Errorf("Call() = %v, want = %v", err, errNotConnected)
+	}
+	if err := client.Notify("Svc.Sum", [2]int{3, 5}); err != errNotConnected {
+		t.Errorf("Notify() = %v, want = %v", err, errNotConnected)
+	}
+	client.Close()
+	if err := client.Call("Svc.Sum", [2]int{3, 5}, nil); err != rpc.ErrShutdown {
+		t.Errorf("Call() after Close = %v, want = %v", err, rpc.ErrShutdown)
+	}
+}
+
+func TestDialReconnecting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go ServeConn(conn)
+		}
+	}()
+
+	client, err := DialReconnecting("tcp", ln.Addr().String(), WithBackoff(Backoff{Min: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var got int
+	if err := client.Call("Svc.Sum", [2]int{1, 2}, &got); err != nil || got != 3 {
+		t.Errorf("Call() = %v, %v", got, err)
+	}
+	(<-conns).Close() // Server drops connection.
+	<-conns
+	waitState(t, client, StateConnected)
+	if err := client.Call("Svc.Sum", [2]int{3, 4}, &got); err != nil || got != 7 {
+		t.Errorf("Call() after reconnect = %v, %v", got, err)
+	}
+
+	if _, err := DialReconnecting("tcp", "127.0.0.1:1"); err == nil {
+		t.Errorf("DialReconnecting(bad addr), err = nil")
+	}
+}
@@ -0,0 +1,123 @@
+package jsonrpc2
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// ResponseMetadata allows RPC method to set HTTP headers and status of
+// response sent by HTTPHandler.
+//
+// Headers and status must be set before method returns (or sends first
+// notification, for streaming response). Content-Type header can't be
+// changed. Headers set by requests in batch are merged, but their status
+// is ignored.
+type ResponseMetadata struct {
+	mu     sync.Mutex // protects header, status
+	header http.Header
+	status int
+	batch  bool // status is ignored
+}
+
+// ResponseMetadataFromContext returns ResponseMetadata related to this
+// RPC (if you use HTTPHandler to serve JSON RPC 2.0 over HTTP) or nil
+// otherwise.
+func ResponseMetadataFromContext(ctx context.Context) *ResponseMetadata {
+	m, _ := ctx.Value(responseMetadataContextKey).(*ResponseMetadata)
+	return m
+}
+
+func newResponseMetadata(batch bool) *ResponseMetadata {
+	return &ResponseMetadata{header: make(http.Header), batch: batch}
+}
+
+// SetHeader sets response header key to value, replacing existing
+// values.
+func (m *ResponseMetadata) SetHeader(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.header.Set(key, value)
+}
+
+// AddHeader adds value to response header key (e.g. "Set-Cookie").
+func (m *ResponseMetadata) AddHeader(key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.header.Add(key, value)
+}
+
+// SetStatus sets HTTP status of response instead of 200 (or 204 for
+// notification). It's ignored for requests in batch and when request
+// was rejected by HTTPHandler (e.g. because of rate limit).
+//
+// Client created by NewHTTPClient accepts reply with any 2xx status
+// except 204 and error reply with status 4xx or 5xx.
+func (m *ResponseMetadata) SetStatus(code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.batch {
+		m.status = code
+	}
+}
+
+// merge adds headers from m2 to m, skipping duplicate values.
+func (m *ResponseMetadata) merge(m2 *ResponseMetadata) {
+	m2.mu.Lock()
+	defer m2.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, values := range m2.header {
+	next:
+		for _, value := range values {
+			for _, v := range m.header[key] {
+				if v == value {
+					continue next
+				}
+			}
+			m.header[key] = append(m.header[key], value)
+		}
+	}
+}
+
+// apply sets headers in h (except Content-Type) and returns status, if
+// any.
+func (m *ResponseMetadata) apply(h http.Header) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, values := range m.header {
+		if key != "Content-Type" {
+			h[key] = append([]string(nil), values...)
+		}
+	}
+	return m.status
+}
+
+// ResponseHeader receives headers of HTTP response to call made by HTTP
+// client, see ContextWithResponseHeader.
+type ResponseHeader struct {
+	mu     sync.Mutex // protects header
+	header http.Header
+}
+
+// ContextWithResponseHeader returns a copy of ctx with rh, which will
+// receive headers of HTTP response to call made by HTTP client with this
+// ctx. If call was sent many times (e.g. retried) then rh will contain
+// headers of last received response.
+func ContextWithResponseHeader(ctx context.Context, rh *ResponseHeader) context.Context {
+	return context.WithValue(ctx, responseHeaderContextKey, rh)
+}
+
+// Header returns a copy of received headers or nil if response wasn't
+// received.
+func (rh *ResponseHeader) Header() http.Header {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	return rh.header.Clone()
+}
+
+func (rh *ResponseHeader) set(h http.Header) {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	rh.header = h.Clone()
+}
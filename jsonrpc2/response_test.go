@@ -0,0 +1,149 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// HeaderSvc is an RPC service for testing.
+type HeaderSvc struct{}
+
+type HeaderArg struct {
+	jsonrpc2.Ctx
+	Set    map[string]string
+	Add    map[string]string
+	Status int
+}
+
+// Set sets response metadata.
+func (HeaderSvc) Set(arg HeaderArg, res *bool) error {
+	m := jsonrpc2.ResponseMetadataFromContext(arg.Context())
+	if m == nil {
+		return nil
+	}
+	for k, v := range arg.Set {
+		m.SetHeader(k, v)
+	}
+	for k, v := range arg.Add {
+		m.AddHeader(k, v)
+		m.AddHeader(k, v+"2")
+	}
+	if arg.Status != 0 {
+		m.SetStatus(arg.Status)
+	}
+	*res = true
+	return nil
+}
+
+func TestResponseMetadata(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(HeaderSvc{})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv))
+	defer ts.Close()
+
+	post := func(body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post(`{"jsonrpc":"2.0","id":1,"method":"HeaderSvc.Set","params":{` +
+		`"Set":{"Cache-Control":"no-store","Content-Type":"text/plain"},` +
+		`"Add":{"Set-Cookie":"a=1"},"Status":202}}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if got := resp.Header["Set-Cookie"]; !reflect.DeepEqual(got, []string{"a=1", "a=12"}) {
+		t.Errorf("Set-Cookie = %q", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	resp = post(`{"jsonrpc":"2.0","method":"HeaderSvc.Set","params":{"Set":{"X-A":"1"},"Status":202}}`)
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("X-A") != "1" {
+		t.Errorf("notification: status = %d, X-A = %q", resp.StatusCode, resp.Header.Get("X-A"))
+	}
+
+	resp = post(`[` +
+		`{"jsonrpc":"2.0","id":1,"method":"HeaderSvc.Set","params":{"Set":{"Cache-Control":"no-store","X-A":"1"},"Status":418}},` +
+		`{"jsonrpc":"2.0","id":2,"method":"HeaderSvc.Set","params":{"Set":{"Cache-Control":"no-store","X-A":"2"}}}]`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("batch: status = %d", resp.StatusCode)
+	}
+	if got := resp.Header["Cache-Control"]; !reflect.DeepEqual(got, []string{"no-store"}) {
+		t.Errorf("batch: Cache-Control = %q", got)
+	}
+	got := resp.Header["X-A"]
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("batch: X-A = %q", got)
+	}
+}
+
+func TestResponseHeader(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(HeaderSvc{})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv))
+	defer ts.Close()
+
+	client := jsonrpc2.NewHTTPClient(ts.URL)
+	defer client.Close()
+	var rh jsonrpc2.ResponseHeader
+	ctx := jsonrpc2.ContextWithResponseHeader(context.Background(), &rh)
+	arg := map[string]map[string]string{"Set": {"X-Cache": "hit"}}
+	var res bool
+	if err := client.CallContext(ctx, "HeaderSvc.Set", arg, &res); err != nil || !res {
+		t.Fatalf("Set() = %v, %v", res, err)
+	}
+	if got := rh.Header().Get("X-Cache"); got != "hit" {
+		t.Errorf("X-Cache = %q", got)
+	}
+
+	var empty jsonrpc2.ResponseHeader
+	if empty.Header() != nil {
+		t.Errorf("Header() = %v, want nil", empty.Header())
+	}
+}
+
+func TestResponseStatusHTTPClient(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(HeaderSvc{})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv))
+	defer ts.Close()
+
+	client := jsonrpc2.NewHTTPClient(ts.URL)
+	defer client.Close()
+	for _, status := range []int{http.StatusCreated, http.StatusAccepted, http.StatusNonAuthoritativeInfo} {
+		var res bool
+		if err := client.Call("HeaderSvc.Set", map[string]int{"Status": status}, &res); err != nil || !res {
+			t.Errorf("status %d: Set() = %v, %v", status, res, err)
+		}
+	}
+	if err := client.Notify("HeaderSvc.Set", map[string]int{"Status": http.StatusCreated}); err != nil {
+		t.Errorf("notification: Set() = %v", err)
+	}
+	var res bool
+	if err := client.Call("HeaderSvc.Set", nil, &res); err != nil || !res {
+		t.Errorf("after notification: Set() = %v, %v", res, err)
+	}
+}
@@ -0,0 +1,102 @@
+package jsonrpc2
+
+import (
+	"context"
+	"io"
+	"net/rpc"
+	"path"
+	"time"
+)
+
+const defaultMaxAttempts = 3
+
+// RetryPolicy describes which failed calls should be retried and how.
+//
+// Only calls made using Call and CallContext are retried, calls made
+// using Go and notifications are never retried.
+type RetryPolicy struct {
+	// MaxAttempts limits amount of attempts including first one
+	// (3 by default).
+	MaxAttempts int
+	// Backoff sets delays between attempts.
+	Backoff Backoff
+	// Methods lists idempotent methods which are safe to retry.
+	// Each entry is a pattern in path.Match syntax, e.g. "Svc.Get*" or
+	// "*" to retry all methods.
+	Methods []string
+	// Retryable reports is call failed with given error should be
+	// retried. Errors rpc.ErrShutdown and io.ErrUnexpectedEOF are always
+	// retried unless client was closed.
+	//
+	// Default is RetryCodes(-32603), which covers transport errors.
+	Retryable func(err *Error) bool
+}
+
+// RetryCodes returns RetryPolicy.Retryable predicate which allows
+// retrying errors with given codes.
+func RetryCodes(codes ...int) func(*Error) bool {
+	return func(err *Error) bool {
+		for _, code := range codes {
+			if err.Code == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchMethod returns true if method matches any of patterns.
+func matchMethod(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RetryPolicy) retryable(err error) bool {
+	switch err {
+	case nil, context.Canceled, context.DeadlineExceeded:
+		return false
+	case rpc.ErrShutdown, io.ErrUnexpectedEOF:
+		return true
+	}
+	e, errNotRPC := serverError(err)
+	if errNotRPC != nil {
+		return false
+	}
+	if r.Retryable == nil {
+		return e.Code == errInternal.Code
+	}
+	return r.Retryable(e)
+}
+
+// do calls call until it succeeds, fails with non-retryable error, amount
+// of attempts exceeds limit, closed returns true or ctx is done.
+// It returns error returned by last attempt.
+func (r *RetryPolicy) do(ctx context.Context, method string, call func() error, closed func() bool) error {
+	err := call()
+	if !matchMethod(r.Methods, method) {
+		return err
+	}
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	for attempt := 1; attempt < maxAttempts && r.retryable(err) && !closed(); attempt++ {
+		delay := r.Backoff.Delay(attempt - 1)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			break
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = call()
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// FlakyHandler fails first Fails requests with 503 Service Unavailable.
+type FlakyHandler struct {
+	Fails    int32
+	Requests int32
+	handler  http.Handler
+}
+
+func (h *FlakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&h.Requests, 1) <= h.Fails {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+func TestRetry(t *testing.T) {
+	policy := jsonrpc2.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     jsonrpc2.Backoff{Min: time.Millisecond},
+		Methods:     []string{"Svc.Sum"},
+	}
+	cases := []struct {
+		method   string
+		fails    int32
+		wantErr  bool
+		requests int32
+	}{
+		{"Svc.Sum", 0, false, 1},
+		{"Svc.Sum", 2, false, 3},
+		{"Svc.Sum", 3, true, 3},
+		{"Svc.SumAll", 1, true, 1},
+	}
+	for _, c := range cases {
+		h := &FlakyHandler{Fails: c.fails, handler: jsonrpc2.HTTPHandler(nil)}
+		ts := httptest.NewServer(h)
+		client := jsonrpc2.NewHTTPClient(ts.URL, jsonrpc2.WithRetry(policy))
+
+		var res int
+		err := client.Call(c.method, [2]int{3, 5}, &res)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s %d: err = %v, wantErr = %v", c.method, c.fails, err, c.wantErr)
+		}
+		if err != nil {
+			if e := jsonrpc2.ServerError(err); e.Code != -32603 {
+				t.Errorf("%s %d: code = %d, want = -32603", c.method, c.fails, e.Code)
+			}
+		} else if res != 8 {
+			t.Errorf("%s %d: res = %d, want = 8", c.method, c.fails, res)
+		}
+		if n := atomic.LoadInt32(&h.Requests); n != c.requests {
+			t.Errorf("%s %d: requests = %d, want = %d", c.method, c.fails, n, c.requests)
+		}
+
+		client.Close()
+		ts.Close()
+	}
+}
+
+func TestRetryNotify(t *testing.T) {
+	h := &FlakyHandler{Fails: 1, handler: jsonrpc2.HTTPHandler(nil)}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL, jsonrpc2.WithRetry(jsonrpc2.RetryPolicy{
+		Backoff: jsonrpc2.Backoff{Min: time.Millisecond},
+		Methods: []string{"*"},
+	}))
+	defer client.Close()
+
+	client.Notify("Svc.Sum", [2]int{3, 5})
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&h.Requests); n != 1 {
+		t.Errorf("requests = %d, want = 1", n)
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	h := &FlakyHandler{Fails: 10, handler: jsonrpc2.HTTPHandler(nil)}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL, jsonrpc2.WithRetry(jsonrpc2.RetryPolicy{
+		MaxAttempts: 10,
+		Backoff:     jsonrpc2.Backoff{Min: time.Second},
+		Methods:     []string{"Svc.*"},
+	}))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var res int
+	err := client.CallContext(ctx, "Svc.Sum", [2]int{3, 5}, &res)
+	if err == nil {
+		t.Errorf("CallContext(), err = nil")
+	}
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("CallContext() took %v", d)
+	}
+	if n := atomic.LoadInt32(&h.Requests); n != 1 {
+		t.Errorf("requests = %d, want = 1", n)
+	}
+}
+
+func TestCallContextLateReply(t *testing.T) {
+	s := newPoolServer(t, 42)
+	defer s.Close()
+	client, err := jsonrpc2.Dial("tcp", s.addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res := -1
+	err = client.CallContext(ctx, "PoolSvc.Block", struct{}{}, &res)
+	if err != context.DeadlineExceeded {
+		t.Errorf("CallContext(), err = %v, want = %v", err, context.DeadlineExceeded)
+	}
+	close(s.svc.block)
+	err = client.CallContext(context.Background(), "PoolSvc.Block", struct{}{}, new(int))
+	if err != nil {
+		t.Errorf("CallContext(), err = %v", err)
+	}
+	if res != -1 {
+		t.Errorf("res = %d, want = -1", res)
+	}
+}
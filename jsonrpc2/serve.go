@@ -0,0 +1,315 @@
+package jsonrpc2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+const shutdownPollInterval = 50 * time.Millisecond
+
+// ErrServerClosed is returned by Server's Serve after a call to Shutdown
+// or Close.
+var ErrServerClosed = errors.New("jsonrpc2: server closed") //nolint:gochecknoglobals
+
+var errShuttingDown = NewError(-32001, "server is shutting down") //nolint:gochecknoglobals
+
+// Server serves JSON-RPC 2.0 connections and keeps track of them to
+// support graceful shutdown.
+type Server struct {
+	srv *rpc.Server
+	o   *options
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*serverConn]struct{}
+	shutdown  bool
+}
+
+// ConnStats describes connection served by Server.
+type ConnStats struct {
+	RemoteAddr string    // Empty if connection isn't a net.Conn.
+	Started    time.Time // When connection was accepted.
+	Calls      uint64    // Amount of received calls.
+	InFlight   int       // Amount of calls being processed.
+}
+
+type serverConn struct {
+	conn  io.ReadWriteCloser
+	codec *serverCodec
+
+	mu       sync.Mutex // protects fields below
+	stats    ConnStats
+	closed   bool
+	draining bool // reject new calls
+}
+
+// NewServer returns a new Server which will use srv to execute requests
+// and configure server codecs for served connections using opts.
+//
+// If srv is nil then rpc.DefaultServer will be used.
+func NewServer(srv *rpc.Server, opts ...Option) *Server {
+	if srv == nil {
+		srv = rpc.DefaultServer
+	}
+	return &Server{
+		srv:       srv,
+		o:         newOptions(opts),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*serverConn]struct{}),
+	}
+}
+
+// Serve accepts connections on l and serves each of them in a new
+// goroutine. Serve always closes l and returns non-nil error: after
+// Shutdown or Close it's ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single connection until the client hangs up or
+// server will be closed. Connection will be closed immediately if server
+// is shutting down.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	s.ServeConnContext(context.Background(), conn)
+}
+
+// ServeConnContext is ServeConn with given context provided
+// within parameters for compatible RPC methods.
+func (s *Server) ServeConnContext(ctx context.Context, conn io.ReadWriteCloser) {
+	sc := &serverConn{conn: conn}
+	sc.stats.Started = time.Now()
+	if c, ok := conn.(interface{ RemoteAddr() net.Addr }); ok {
+		sc.stats.RemoteAddr = c.RemoteAddr().String()
+	}
+	sc.codec = newServerCodec(ctx, conn, s.srv, s.o)
+	sc.codec.sconn = sc
+	if !s.trackConn(sc, true) {
+		_ = conn.Close()
+		return
+	}
+	defer s.trackConn(sc, false)
+	s.srv.ServeCodec(sc.codec)
+}
+
+// Shutdown gracefully shuts down the server: it closes all listeners,
+// makes served connections reject new requests with error code -32001
+// (after sending notification configured by WithShutdownNotification),
+// waits until all requests in progress will be completed and closes
+// connections when they become idle.
+//
+// If ctx expires before that Shutdown returns ctx's error, use Close to
+// close remaining connections.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	s.closeListenersLocked()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close immediately closes all listeners and connections. Requests
+// in progress will continue running, but their responses will be lost.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown = true
+	s.closeListenersLocked()
+	for sc := range s.conns {
+		sc.close()
+	}
+	return nil
+}
+
+// Conns returns statistics for all served connections.
+func (s *Server) Conns() []ConnStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make([]ConnStats, 0, len(s.conns))
+	for sc := range s.conns {
+		sc.mu.Lock()
+		stats = append(stats, sc.stats)
+		sc.mu.Unlock()
+	}
+	return stats
+}
+
+// InFlight returns amount of calls being processed on all served
+// connections.
+func (s *Server) InFlight() int {
+	n := 0
+	for _, stats := range s.Conns() {
+		n += stats.InFlight
+	}
+	return n
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdown
+}
+
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.shutdown {
+		return false
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+func (s *Server) trackConn(sc *serverConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.conns, sc)
+		return true
+	}
+	if s.shutdown {
+		return false
+	}
+	s.conns[sc] = struct{}{}
+	return true
+}
+
+func (s *Server) closeListenersLocked() {
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+}
+
+// closeIdleConns notifies connections about shutdown, closes idle ones
+// and returns true if all connections are closed.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	conns := make([]*serverConn, 0, len(s.conns))
+	for sc := range s.conns {
+		conns = append(conns, sc)
+	}
+	s.mu.Unlock()
+	quiescent := true
+	for _, sc := range conns {
+		sc.drain(s.o.shutdownNotify)
+		if !sc.closeIfIdle() {
+			quiescent = false
+		}
+	}
+	return quiescent
+}
+
+// callStarted returns false if connection doesn't accept new calls,
+// otherwise call must be reported using callFinished.
+func (sc *serverConn) callStarted() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.draining {
+		return false
+	}
+	sc.stats.Calls++
+	sc.stats.InFlight++
+	return true
+}
+
+func (sc *serverConn) callFinished() {
+	sc.mu.Lock()
+	sc.stats.InFlight--
+	sc.mu.Unlock()
+}
+
+// drain makes connection reject new calls and sends notification with
+// given method (if any) on first call.
+func (sc *serverConn) drain(method string) {
+	sc.mu.Lock()
+	notify := method != "" && !sc.draining && !sc.closed
+	sc.draining = true
+	sc.mu.Unlock()
+	if notify {
+		sc.codec.notify(method)
+	}
+}
+
+func (sc *serverConn) closeIfIdle() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.stats.InFlight > 0 {
+		return false
+	}
+	sc.closeLocked()
+	return true
+}
+
+func (sc *serverConn) close() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.closeLocked()
+}
+
+func (sc *serverConn) closeLocked() {
+	if !sc.closed {
+		sc.closed = true
+		_ = sc.conn.Close()
+	}
+}
+
+func (sc *serverConn) isClosed() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.closed
+}
+
+// startCall registers current request on tracked connection or replies
+// with error and returns errHandled if server is shutting down.
+func (c *serverCodec) startCall() error {
+	if c.sconn == nil || c.sconn.callStarted() {
+		return nil
+	}
+	c.respond(nil, errShuttingDown)
+	return errHandled
+}
+
+// notify sends notification with given method and without params.
+func (c *serverCodec) notify(method string) {
+	n, _ := newServerNotification(method, nil)
+	c.encmutex.Lock()
+	err := c.enc.Encode(n)
+	c.encmutex.Unlock()
+	if err != nil {
+		c.o.logger.Warn("failed to write notification", "method", method, "err", err)
+	}
+}
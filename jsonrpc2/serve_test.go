@@ -0,0 +1,141 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// DrainSvc is an RPC service for testing.
+type DrainSvc struct{ release chan struct{} }
+
+// Wait blocks until release is closed.
+func (svc *DrainSvc) Wait(struct{}, *struct{}) error {
+	<-svc.release
+	return nil
+}
+
+// Ping returns immediately.
+func (svc *DrainSvc) Ping(struct{}, *struct{}) error {
+	return nil
+}
+
+func startServer(t *testing.T, opts ...jsonrpc2.Option) (*jsonrpc2.Server, *DrainSvc, string, chan error) {
+	t.Helper()
+	svc := &DrainSvc{release: make(chan struct{})}
+	srv := rpc.NewServer()
+	srv.Register(svc)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := jsonrpc2.NewServer(srv, opts...)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ln) }()
+	return s, svc, ln.Addr().String(), served
+}
+
+func waitInFlight(t *testing.T, s *jsonrpc2.Server, n int) {
+	t.Helper()
+	for i := 0; s.InFlight() != n; i++ {
+		if i == 200 {
+			t.Fatalf("InFlight() = %d, want %d", s.InFlight(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s, svc, addr, served := startServer(t, jsonrpc2.WithShutdownNotification("rpc.shutdown"))
+	client, err := jsonrpc2.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	idle, err := jsonrpc2.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	if err := idle.Call("DrainSvc.Ping", struct{}{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	call := client.Go("DrainSvc.Wait", struct{}{}, nil, nil)
+	waitInFlight(t, s, 1)
+	if conns := s.Conns(); len(conns) != 2 {
+		t.Errorf("Conns() = %v", conns)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	if err := <-served; err != jsonrpc2.ErrServerClosed {
+		t.Errorf("Serve() = %v", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Errorf("listener is not closed")
+	}
+	for i := 0; len(s.Conns()) != 1; i++ {
+		if i == 200 {
+			t.Fatalf("idle conn is not closed: %v", s.Conns())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rpcerr := jsonrpc2.ServerError(client.Call("DrainSvc.Ping", struct{}{}, nil))
+	if rpcerr == nil || rpcerr.Code != -32001 {
+		t.Errorf("call while shutting down: err = %v", rpcerr)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown() = %v before in-flight call finished", err)
+	default:
+	}
+
+	close(svc.release)
+	if (<-call.Done).Error != nil {
+		t.Errorf("in-flight call: err = %v", call.Error)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() = %v", err)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s, svc, addr, served := startServer(t)
+	defer close(svc.release)
+	client, err := jsonrpc2.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	call := client.Go("DrainSvc.Wait", struct{}{}, nil, nil)
+	waitInFlight(t, s, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() = %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+	if err := <-served; err != jsonrpc2.ErrServerClosed {
+		t.Errorf("Serve() = %v", err)
+	}
+	if (<-call.Done).Error == nil {
+		t.Errorf("in-flight call succeeded after Close")
+	}
+
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	s.ServeConn(srv)
+	if _, err := cli.Write([]byte("{}")); err == nil {
+		t.Errorf("conn is served after Close")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"net/rpc"
 	"sync"
+	"time"
 )
 
 const (
@@ -19,16 +20,34 @@ const (
 	protoVer    = "2.0"
 )
 
+// errHandled is returned by request checks when current request was
+// already replied and should not be processed.
+var errHandled = errors.New("request handled") //nolint:gochecknoglobals
+
 type serverCodec struct {
 	encmutex sync.Mutex    // protects enc
 	dec      *json.Decoder // for reading JSON values
 	enc      *json.Encoder // for writing JSON values
 	c        io.Closer
+	lr       *limitReader   // set only if message size is limited
+	tr       *timeoutReader // set only if read timeouts are used
 	srv      *rpc.Server
 	ctx      context.Context
+	o        *options
+	slots    chan struct{} // set only if in-flight requests are limited
+	sconn    *serverConn   // set only for connection served by Server
+
+	// abandoned is closed when single request served by serveRequest
+	// timed out.
+	abandoned chan struct{}
+
+	authTried bool // authentication using TLS identity was tried
 
 	// temporary work space
-	req serverRequest
+	req    serverRequest
+	reqCtx context.Context
+
+	batchReq json.RawMessage // set only for codec created by newBatchCodec
 
 	// JSON-RPC clients can use arbitrary json values as request IDs.
 	// Package rpc expects uint64 request IDs.
@@ -38,7 +57,18 @@ type serverCodec struct {
 	// the response to find the original request ID.
 	mutex   sync.Mutex // protects seq, pending
 	seq     uint64
-	pending map[uint64]*json.RawMessage
+	pending map[uint64]pendingResponse
+}
+
+type pendingResponse struct {
+	id       *json.RawMessage
+	method   string
+	label    string    // method reported to metrics, set only if metrics is enabled
+	start    time.Time // set only if access log or metrics is enabled
+	span     Span
+	cancel   context.CancelFunc // set only if call has a deadline
+	timer    *time.Timer        // set only if call timeout is used
+	timedOut chan struct{}      // closed after timeout error was sent
 }
 
 // NewServerCodec returns a new rpc.ServerCodec using JSON-RPC 2.0 on conn,
@@ -51,27 +81,61 @@ type serverCodec struct {
 // your own object of type named "JSONRPC2" (same as used internally to
 // process batch requests) or you wanna use custom rpc server object
 // instead of rpc.DefaultServer to process requests on conn.
-func NewServerCodec(conn io.ReadWriteCloser, srv *rpc.Server) rpc.ServerCodec {
+func NewServerCodec(conn io.ReadWriteCloser, srv *rpc.Server, opts ...Option) rpc.ServerCodec {
+	return newServerCodec(context.Background(), conn, srv, newOptions(opts))
+}
+
+// NewServerCodecContext is NewServerCodec with given context provided
+// within parameters for compatible RPC methods.
+func NewServerCodecContext(ctx context.Context, conn io.ReadWriteCloser, srv *rpc.Server, opts ...Option) rpc.ServerCodec {
+	return newServerCodec(ctx, conn, srv, newOptions(opts))
+}
+
+func newServerCodec(ctx context.Context, conn io.ReadWriteCloser, srv *rpc.Server, o *options) *serverCodec {
 	if srv == nil {
 		srv = rpc.DefaultServer
 	}
 	_ = srv.Register(JSONRPC2{})
-	return &serverCodec{
-		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
+	if len(o.rateLimits) > 0 {
+		ctx = withConnInfo(ctx, conn)
+	}
+	c := &serverCodec{
+		enc:     json.NewEncoder(newTimeoutWriter(conn, o)),
 		c:       conn,
 		srv:     srv,
-		ctx:     context.Background(),
-		pending: make(map[uint64]*json.RawMessage),
+		ctx:     ctx,
+		o:       o,
+		req:     serverRequest{metaMember: o.metaMember},
+		pending: make(map[uint64]pendingResponse),
+	}
+	var r io.Reader = conn
+	if c.tr = newTimeoutReader(conn, o); c.tr != nil {
+		r = c.tr
+	}
+	if o.maxMsgSize > 0 {
+		c.lr = &limitReader{r: r}
+		r = c.lr
+	}
+	c.dec = json.NewDecoder(r)
+	if o.maxConcurrent > 0 {
+		c.slots = make(chan struct{}, o.maxConcurrent)
 	}
+	return c
 }
 
-// NewServerCodecContext is NewServerCodec with given context provided
-// within parameters for compatible RPC methods.
-func NewServerCodecContext(ctx context.Context, conn io.ReadWriteCloser, srv *rpc.Server) rpc.ServerCodec {
-	codec := NewServerCodec(conn, srv)
-	codec.(*serverCodec).ctx = ctx
-	return codec
+// newBatchCodec returns codec which processes single request req from
+// batch (using srv) and writes reply to conn.
+func newBatchCodec(ctx context.Context, conn io.WriteCloser, srv *rpc.Server, o *options, req json.RawMessage) *serverCodec {
+	return &serverCodec{
+		enc:      json.NewEncoder(conn),
+		c:        conn,
+		srv:      srv,
+		ctx:      ctx,
+		o:        o,
+		req:      serverRequest{metaMember: o.metaMember},
+		pending:  make(map[uint64]pendingResponse, 1),
+		batchReq: req,
+	}
 }
 
 type serverRequest struct {
@@ -79,6 +143,9 @@ type serverRequest struct {
 	Method  string           `json:"method"`
 	Params  *json.RawMessage `json:"params"`
 	ID      *json.RawMessage `json:"id"`
+	Meta    *json.RawMessage `json:"-"`
+
+	metaMember string // name of reserved member with Meta, if any
 }
 
 func (r *serverRequest) reset() {
@@ -86,12 +153,13 @@ func (r *serverRequest) reset() {
 	r.Method = ""
 	r.Params = nil
 	r.ID = nil
+	r.Meta = nil
 }
 
 func (r *serverRequest) UnmarshalJSON(raw []byte) error {
 	r.reset()
-	type req *serverRequest
-	if err := json.Unmarshal(raw, req(r)); err != nil {
+	type req serverRequest
+	if err := json.Unmarshal(raw, (*req)(r)); err != nil {
 		return errors.New("bad request")
 	}
 
@@ -102,6 +170,10 @@ func (r *serverRequest) UnmarshalJSON(raw []byte) error {
 	if o["jsonrpc"] == nil || o["method"] == nil {
 		return errors.New("bad request")
 	}
+	if meta, ok := o[r.metaMember]; ok && r.metaMember != "" {
+		r.Meta = meta
+		delete(o, r.metaMember)
+	}
 	_, okID := o["id"]
 	_, okParams := o["params"]
 	if len(o) == 3 && !(okID || okParams) || len(o) == 4 && !(okID && okParams) || len(o) > 4 {
@@ -143,25 +215,62 @@ type serverResponse struct {
 	Error   interface{}      `json:"error,omitempty"`
 }
 
-func (c *serverCodec) ReadRequestHeader(r *rpc.Request) (err error) {
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
 	// If return error:
 	// - codec will be closed
 	// So, try to send error reply to client before returning error.
-	var raw json.RawMessage
-	if err := c.dec.Decode(&raw); err != nil {
+	for handled := false; ; handled = true {
+		if err := c.readRequestHeader(r, handled); err != errHandled {
+			return err
+		}
+	}
+}
+
+// readRequestHeader reads next request, handled is true if previous
+// request was already handled without returning it to rpc.Server.
+func (c *serverCodec) readRequestHeader(r *rpc.Request, handled bool) error {
+	raw, err := c.readMessage()
+	if err == io.EOF && handled || err != nil && c.sconn != nil && c.sconn.isClosed() {
+		return err
+	}
+	if isTimeout(err) {
+		c.o.logger.Info("connection timeout", "err", err)
+		return err
+	}
+	if err != nil {
+		errResp := errParse
+		if errors.Is(err, errTooLarge) {
+			errResp = errMsgTooLarge
+		}
+		if err != io.EOF {
+			c.o.logger.Warn("parse error", "err", err)
+			c.protocolError(errResp)
+		}
 		c.encmutex.Lock()
-		_ = c.enc.Encode(serverResponse{Version: protoVer, ID: &null, Error: errParse})
+		_ = c.enc.Encode(serverResponse{Version: protoVer, ID: &null, Error: errResp})
 		c.encmutex.Unlock()
 		return err
 	}
 
+	if c.o.maxDepth > 0 && jsonDepth(raw) > c.o.maxDepth {
+		c.o.logger.Warn("invalid request", "err", errTooDeep.Message, "request", truncate(raw))
+		c.protocolError(errTooDeep)
+		c.encmutex.Lock()
+		_ = c.enc.Encode(serverResponse{Version: protoVer, ID: &null, Error: errTooDeep})
+		c.encmutex.Unlock()
+		return errTooDeep
+	}
+
 	if len(raw) > 0 && raw[0] == '[' {
 		c.req.Version = protoVer
 		c.req.Method = batchMethod
 		c.req.Params = &raw
 		c.req.ID = &null
+		c.req.Meta = nil
 	} else if err := json.Unmarshal(raw, &c.req); err != nil {
 		if err.Error() == "bad request" {
+			c.o.logger.Warn("invalid request", "request", truncate(raw))
+			c.protocolError(errRequest)
 			c.encmutex.Lock()
 			_ = c.enc.Encode(serverResponse{Version: protoVer, ID: &null, Error: errRequest})
 			c.encmutex.Unlock()
@@ -169,21 +278,91 @@ func (c *serverCodec) ReadRequestHeader(r *rpc.Request) (err error) {
 		return err
 	}
 
-	r.ServiceMethod = c.req.Method
+	if err := c.authenticate(); err != nil {
+		return err
+	}
+	if err := c.authorize(); err != nil {
+		return err
+	}
+	if err := c.rateLimit(); err != nil {
+		return err
+	}
+	if err := c.startCall(); err != nil {
+		return err
+	}
+
+	r.ServiceMethod = handlerMethodName(c.srv, c.req.Method)
+	ctx, cancel, span := c.requestContext()
+
+	if c.slots != nil {
+		c.slots <- struct{}{}
+	}
 
 	// JSON request id can be any JSON value;
 	// RPC package expects uint64.  Translate to
 	// internal uint64 and save JSON on the side.
 	c.mutex.Lock()
 	c.seq++
-	c.pending[c.seq] = c.req.ID
+	p := pendingResponse{id: c.req.ID, method: c.req.Method, span: span, cancel: cancel}
+	if c.o.accessLog || c.o.metrics != nil {
+		p.start = time.Now()
+	}
+	if c.o.metrics != nil && p.method != batchMethod {
+		p.label = metricMethod(c.srv, p.method)
+		c.o.metrics.CallStarted(ServerSide, p.label)
+	}
+	ctx = c.withCallTimeout(ctx, &p, c.seq)
+	c.pending[c.seq] = p
+	c.tr.setBusy(len(c.pending))
 	c.req.ID = nil
 	r.Seq = c.seq
 	c.mutex.Unlock()
+	c.reqCtx = ctx
 
 	return nil
 }
 
+// readMessage returns next message from batch request or conn.
+func (c *serverCodec) readMessage() (raw json.RawMessage, err error) {
+	switch {
+	case c.batchReq != nil:
+		raw, c.batchReq = c.batchReq, nil
+		return raw, nil
+	case c.dec == nil:
+		return nil, io.EOF
+	case c.lr != nil:
+		c.lr.limit = c.dec.InputOffset() + c.o.maxMsgSize
+	}
+	c.tr.wait()
+	err = c.dec.Decode(&raw)
+	return raw, err
+}
+
+// requestContext returns context for current request with received span
+// context and deadline (cancel is nil if there is no deadline) and span
+// started by tracer (if any).
+func (c *serverCodec) requestContext() (ctx context.Context, cancel context.CancelFunc, span Span) {
+	ctx = c.ctx
+	if c.req.Meta != nil {
+		var meta map[string]string
+		_ = json.Unmarshal(*c.req.Meta, &meta)
+		if sc, err := ParseTraceparent(meta[traceparentMeta]); err == nil {
+			ctx = ContextWithSpanContext(ctx, sc)
+		}
+		if md := requestMetadata(meta); md != nil {
+			ctx = context.WithValue(ctx, incomingMetadataContextKey, md)
+		}
+		if c.o.propagateDeadline {
+			ctx, cancel = withTimeout(ctx, meta[timeoutMeta])
+		}
+	}
+	if c.req.Method == batchMethod {
+		return ctx, cancel, nil
+	}
+	ctx, span = startSpan(ctx, c.o.tracer, ServerSide, c.req.Method)
+	return ctx, cancel, span
+}
+
 func (c *serverCodec) ReadRequestBody(x interface{}) error {
 	// If x!=nil and return error e:
 	// - WriteResponse() will be called with e.Error() in r.Error
@@ -191,14 +370,18 @@ func (c *serverCodec) ReadRequestBody(x interface{}) error {
 		return nil
 	}
 	if x, ok := x.(WithContext); ok {
-		x.SetContext(c.ctx)
+		x.SetContext(c.reqCtx)
 	}
 	if c.req.Params == nil {
 		return nil
 	}
 	if c.req.Method == batchMethod {
+		if c.o.maxBatchLen > 0 && jsonArrayLen(*c.req.Params) > c.o.maxBatchLen {
+			return errBatchTooLarge
+		}
 		arg := x.(*BatchArg)
 		arg.srv = c.srv
+		arg.o = c.o
 		if err := json.Unmarshal(*c.req.Params, &arg.reqs); err != nil {
 			return NewError(errParams.Code, err.Error())
 		}
@@ -219,21 +402,34 @@ func (c *serverCodec) WriteResponse(r *rpc.Response, x interface{}) error {
 	// - ReadRequestBody()
 	// - called RPC method
 	c.mutex.Lock()
-	b, ok := c.pending[r.Seq]
+	p, ok := c.pending[r.Seq]
 	if !ok {
 		c.mutex.Unlock()
+		c.o.logger.Error("dropped response", "method", r.ServiceMethod, "seq", r.Seq)
 		return errors.New("invalid sequence number in response")
 	}
 	delete(c.pending, r.Seq)
+	c.tr.setBusy(len(c.pending))
 	c.mutex.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.timedOut != nil {
+		<-p.timedOut
+		c.o.logger.Debug("dropped late response", "method", p.method, "id", rawString(p.id))
+		return nil
+	}
+	c.finishCall(p, responseError(r.Error))
+	b := p.id
 
 	if replies, ok := x.(*[]*json.RawMessage); r.ServiceMethod == batchMethod && ok {
 		if len(*replies) == 0 {
 			return nil
 		}
-		c.encmutex.Lock()
-		defer c.encmutex.Unlock()
-		return c.enc.Encode(replies)
+		return c.encode(r, replies)
 	}
 
 	if b == nil {
@@ -259,9 +455,103 @@ func (c *serverCodec) WriteResponse(r *rpc.Response, x interface{}) error {
 		raw := json.RawMessage(newError(r.Error).Error())
 		resp.Error = &raw
 	}
+	return c.encode(r, resp)
+}
+
+// finishCall releases resources used by call and reports it's result.
+func (c *serverCodec) finishCall(p pendingResponse, err *Error) {
+	if c.sconn != nil {
+		defer c.sconn.callFinished()
+	}
+	if c.slots != nil {
+		<-c.slots
+	}
+	endSpan(p.span, err)
+	if (c.o.accessLog || c.o.metrics != nil) && p.method != batchMethod {
+		code := 0
+		if err != nil {
+			code = err.Code
+		}
+		if c.o.accessLog {
+			c.o.logger.Info("call", "method", p.method, "id", rawString(p.id),
+				"duration", time.Since(p.start), "code", code)
+		}
+		if c.o.metrics != nil {
+			c.o.metrics.CallFinished(ServerSide, p.label, code, time.Since(p.start))
+		}
+	}
+}
+
+func (c *serverCodec) encode(r *rpc.Response, resp interface{}) error {
 	c.encmutex.Lock()
-	defer c.encmutex.Unlock()
-	return c.enc.Encode(resp)
+	err := c.enc.Encode(resp)
+	c.encmutex.Unlock()
+	if err != nil {
+		c.o.logger.Warn("failed to write response", "method", r.ServiceMethod, "err", err)
+	}
+	return err
+}
+
+// respond replies to current request with result or err without
+// processing it.
+func (c *serverCodec) respond(result interface{}, err *Error) {
+	code := 0
+	if err != nil {
+		code = err.Code
+	}
+	if c.o.accessLog {
+		c.o.logger.Info("call", "method", c.req.Method, "id", rawString(c.req.ID), "duration", time.Duration(0), "code", code)
+	}
+	if c.o.metrics != nil {
+		label := metricMethod(c.srv, c.req.Method)
+		c.o.metrics.CallStarted(ServerSide, label)
+		c.o.metrics.CallFinished(ServerSide, label, code, 0)
+	}
+	if c.req.ID == nil {
+		return
+	}
+	resp := serverResponse{Version: protoVer, ID: c.req.ID, Result: result}
+	if err != nil {
+		resp.Error = err
+	}
+	c.encmutex.Lock()
+	errEnc := c.enc.Encode(resp)
+	c.encmutex.Unlock()
+	if errEnc != nil {
+		c.o.logger.Warn("failed to write response", "method", c.req.Method, "err", errEnc)
+	}
+}
+
+// protocolError reports request which failed before it was processed.
+func (c *serverCodec) protocolError(err *Error) {
+	if c.o.metrics != nil {
+		c.o.metrics.CallStarted(ServerSide, "")
+		c.o.metrics.CallFinished(ServerSide, "", err.Code, 0)
+	}
+}
+
+// responseError returns error returned by RPC method as *Error.
+func responseError(rpcerr string) *Error {
+	switch {
+	case rpcerr == "":
+		return nil
+	case rpcerr[0] == '{':
+		var e Error
+		if json.Unmarshal([]byte(rpcerr), &e) == nil {
+			return &e
+		}
+		return NewError(errServer.Code, rpcerr)
+	default:
+		return newError(rpcerr)
+	}
+}
+
+// rawString returns raw as string or empty string if raw is nil.
+func rawString(raw *json.RawMessage) string {
+	if raw == nil {
+		return ""
+	}
+	return string(*raw)
 }
 
 func (c *serverCodec) Close() error {
@@ -0,0 +1,139 @@
+package jsonrpc2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/rpc"
+)
+
+const contentTypeStream = "text/event-stream"
+
+// Notification represent JSON-RPC 2.0 notification sent by server while
+// processing streaming call.
+type Notification struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Notifier is an interface for sending notifications to client while RPC
+// method is processing request.
+type Notifier interface {
+	// Notify sends notification with given method and params (params
+	// must be nil, Array, Slice, Map or Struct).
+	Notify(method string, params interface{}) error
+}
+
+// NotifierFromContext returns Notifier related to this RPC (if client
+// requested streaming response using HTTP transport) or nil otherwise.
+func NotifierFromContext(ctx context.Context) Notifier {
+	n, _ := ctx.Value(notifierContextKey).(Notifier)
+	return n
+}
+
+type serverNotification struct {
+	Version string           `json:"jsonrpc"`
+	Method  string           `json:"method"`
+	Params  *json.RawMessage `json:"params,omitempty"`
+}
+
+func newServerNotification(method string, params interface{}) (*serverNotification, error) {
+	n := &serverNotification{Version: protoVer, Method: method}
+	if params == nil {
+		return n, nil
+	}
+	buf, err := json.Marshal(params)
+	if err != nil {
+		return nil, NewError(errInternal.Code, err.Error())
+	}
+	switch buf[0] {
+	case '[', '{':
+		raw := json.RawMessage(buf)
+		n.Params = &raw
+	case 'n':
+	default:
+		return nil, NewError(errInternal.Code, "unsupported param type: "+string(buf))
+	}
+	return n, nil
+}
+
+// GoStream invokes the function asynchronously just like Go, but also
+// asks server to stream notifications sent by RPC method while
+// processing this call (see NotifierFromContext).
+//
+// All received notifications will be sent to notifications channel
+// before the call will be done. Channel won't be closed and must be read
+// until the call is done, otherwise this call will be blocked (until
+// its context is done) and will hold one of in-flight request slots
+// (see WithMaxInFlight). Other calls are not affected while there are
+// free slots.
+//
+// Streaming is supported only by HTTP transport, other transports will
+// handle GoStream just like Go.
+func (c Client) GoStream(serviceMethod string, args, reply interface{}, done chan *rpc.Call, notifications chan<- *Notification) *rpc.Call {
+	ctx := context.WithValue(context.Background(), notificationsContextKey, notifications)
+	call := c.Go(serviceMethod, &callArgs{ctx: ctx, args: args}, reply, done)
+	call.Args = args
+	return call
+}
+
+// writeEvent writes data as a Server-Sent Event.
+func writeEvent(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	for _, line := range bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readEvents reads Server-Sent Events from r and calls fn with data of
+// each event until r returns io.EOF or fn returns error.
+func readEvents(r io.Reader, fn func(data []byte) error) error {
+	br := bufio.NewReader(r)
+	var data []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = nil // Incomplete event must be discarded.
+			}
+			return err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0:
+			if data != nil {
+				if err := fn(bytes.TrimSuffix(data, []byte("\n"))); err != nil {
+					return err
+				}
+			}
+			data = nil
+		case line[0] == ':':
+			// Comment.
+		default:
+			field, value := line, []byte(nil)
+			if i := bytes.IndexByte(line, ':'); i != -1 {
+				field, value = line[:i], bytes.TrimPrefix(line[i+1:], []byte(" "))
+			}
+			if string(field) == "data" {
+				data = append(append(data, value...), '\n')
+			}
+		}
+	}
+}
+
+// isNotification returns true if data contains JSON-RPC 2.0 notification.
+func isNotification(data []byte) bool {
+	var o map[string]*json.RawMessage
+	if json.Unmarshal(data, &o) != nil {
+		return false
+	}
+	_, okID := o["id"]
+	return !okID && o["method"] != nil
+}
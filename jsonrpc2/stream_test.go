@@ -0,0 +1,134 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// StreamSvc is an RPC service for testing.
+type StreamSvc struct{}
+
+type CountArgs struct {
+	N int
+	jsonrpc2.Ctx
+}
+
+func (*StreamSvc) Count(args CountArgs, res *int) error {
+	n := jsonrpc2.NotifierFromContext(args.Context())
+	for i := 1; i <= args.N; i++ {
+		if n != nil {
+			if err := n.Notify("progress", [1]int{i}); err != nil {
+				return err
+			}
+		}
+		*res = i
+	}
+	return nil
+}
+
+func newStreamServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := rpc.NewServer()
+	if err := srv.Register(&StreamSvc{}); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(jsonrpc2.HTTPHandler(srv))
+}
+
+func TestHTTPStreamServer(t *testing.T) {
+	ts := newStreamServer(t)
+	defer ts.Close()
+
+	cases := []struct {
+		accept      string
+		body        string
+		code        int
+		contentType string
+		reply       string
+	}{
+		{"application/json", `{"jsonrpc":"2.0","id":1,"method":"StreamSvc.Count","params":{"N":2}}`,
+			http.StatusOK, "application/json",
+			`{"jsonrpc":"2.0","id":1,"result":2}` + "\n"},
+		{"text/event-stream", `{"jsonrpc":"2.0","id":1,"method":"StreamSvc.Count","params":{"N":2}}`,
+			http.StatusOK, "text/event-stream",
+			`data: {"jsonrpc":"2.0","method":"progress","params":[1]}` + "\n\n" +
+				`data: {"jsonrpc":"2.0","method":"progress","params":[2]}` + "\n\n" +
+				`data: {"jsonrpc":"2.0","id":1,"result":2}` + "\n\n"},
+		{"text/event-stream", `{"jsonrpc":"2.0","method":"StreamSvc.Count","params":{"N":0}}`,
+			http.StatusNoContent, "text/event-stream",
+			""},
+		{"text/html", `{"jsonrpc":"2.0","id":1,"method":"StreamSvc.Count","params":{"N":2}}`,
+			http.StatusUnsupportedMediaType, "application/json",
+			""},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest("POST", ts.URL, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", c.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("ReadAll(), err = %v", err)
+		}
+		if resp.StatusCode != c.code {
+			t.Errorf("%s: status = %v, want = %v", c.accept, resp.StatusCode, c.code)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != c.contentType {
+			t.Errorf("%s: Content-Type = %q, want = %q", c.accept, ct, c.contentType)
+		}
+		if string(got) != c.reply {
+			t.Errorf("%s:\nexp: %#q\ngot: %#q", c.accept, c.reply, got)
+		}
+	}
+}
+
+func TestHTTPStreamClient(t *testing.T) {
+	ts := newStreamServer(t)
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL)
+	defer client.Close()
+
+	var got int
+	notifications := make(chan *jsonrpc2.Notification)
+	call := client.GoStream("StreamSvc.Count", CountArgs{N: 3}, &got, nil, notifications)
+	var params []string
+	for done := false; !done; {
+		select {
+		case n := <-notifications:
+			if n.Method != "progress" {
+				t.Errorf("Method = %q, want = progress", n.Method)
+			}
+			params = append(params, string(n.Params))
+		case <-call.Done:
+			done = true
+		}
+	}
+	if call.Error != nil {
+		t.Errorf("GoStream(), err = %v", call.Error)
+	}
+	if got != 3 {
+		t.Errorf("GoStream() = %v, want = 3", got)
+	}
+	if want := "[1] [2] [3]"; strings.Join(params, " ") != want {
+		t.Errorf("notifications = %v, want = %v", params, want)
+	}
+
+	err := client.Call("StreamSvc.Count", CountArgs{N: 2}, &got)
+	if err != nil || got != 2 {
+		t.Errorf("Call() = %v, %v, want = 2, nil", got, err)
+	}
+}
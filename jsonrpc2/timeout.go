@@ -0,0 +1,238 @@
+package jsonrpc2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/rpc"
+	"os"
+	"sync"
+	"time"
+)
+
+var errCallTimeout = NewError(-32000, "call timeout") //nolint:gochecknoglobals
+
+// CallTimeout limits time used by server to process calls.
+type CallTimeout struct {
+	// Timeout for processing call, zero means unlimited.
+	Timeout time.Duration
+	// Methods is a list of path.Match patterns like "Svc.*" to limit,
+	// all methods are limited by default.
+	Methods []string
+	// Error is returned for timed out calls (code -32000 by default).
+	// Its Data will be set to object with "timeout" member with amount
+	// of seconds.
+	Error *Error
+}
+
+// timeoutError returns error for call which wasn't completed in time.
+func (t *CallTimeout) timeoutError() *Error {
+	err := *errCallTimeout
+	if t.Error != nil {
+		err = *t.Error
+	}
+	err.Data = map[string]float64{"timeout": t.Timeout.Seconds()}
+	return &err
+}
+
+// callTimeout returns last added call timeout for method, if any.
+func (o *options) callTimeout(method string) *CallTimeout {
+	for i := len(o.callTimeouts) - 1; i >= 0; i-- {
+		t := &o.callTimeouts[i]
+		if t.Methods == nil || matchMethod(t.Methods, method) {
+			if t.Timeout <= 0 {
+				return nil
+			}
+			return t
+		}
+	}
+	return nil
+}
+
+// withCallTimeout returns ctx for current request with deadline and
+// starts timer which will reply with timeout error to request with
+// given seq unless it'll be completed in time.
+func (c *serverCodec) withCallTimeout(ctx context.Context, p *pendingResponse, seq uint64) context.Context {
+	if c.req.Method == batchMethod {
+		return ctx
+	}
+	t := c.o.callTimeout(c.req.Method)
+	if t == nil {
+		return ctx
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	if prev := p.cancel; prev != nil {
+		p.cancel = func() { cancel(); prev() }
+	} else {
+		p.cancel = cancel
+	}
+	p.timer = time.AfterFunc(t.Timeout, func() { c.callTimedOut(seq, t) })
+	return ctx
+}
+
+// callTimedOut replies with timeout error to request with given seq (if
+// it's still in progress) and makes WriteResponse drop late result.
+func (c *serverCodec) callTimedOut(seq uint64, t *CallTimeout) {
+	c.mutex.Lock()
+	p, ok := c.pending[seq]
+	if !ok {
+		c.mutex.Unlock()
+		return
+	}
+	p.timedOut = make(chan struct{})
+	c.pending[seq] = p
+	c.mutex.Unlock()
+	defer close(p.timedOut)
+
+	err := t.timeoutError()
+	c.o.logger.Warn("call timeout", "method", p.method, "id", rawString(p.id), "timeout", t.Timeout)
+	c.finishCall(p, err)
+	if c.abandoned != nil {
+		defer close(c.abandoned)
+	}
+	if p.id == nil {
+		return
+	}
+	c.encmutex.Lock()
+	errEnc := c.enc.Encode(serverResponse{Version: protoVer, ID: p.id, Error: err})
+	c.encmutex.Unlock()
+	if errEnc != nil {
+		c.o.logger.Warn("failed to write response", "method", p.method, "err", errEnc)
+	}
+}
+
+// serveRequest processes single request from c like srv.ServeRequest,
+// but returns without waiting for method if call timed out.
+func serveRequest(srv *rpc.Server, c *serverCodec) {
+	if len(c.o.callTimeouts) == 0 {
+		_ = srv.ServeRequest(c)
+		return
+	}
+	c.abandoned = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		_ = srv.ServeRequest(c)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-c.abandoned:
+	}
+}
+
+// deadliner is implemented by connections which support deadlines
+// (e.g. net.Conn).
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// timeoutReader sets read deadline on conn: idle timeout while waiting
+// for next message without calls in progress and read timeout while
+// reading message.
+type timeoutReader struct {
+	r    io.Reader
+	d    deadliner
+	idle time.Duration
+	read time.Duration
+
+	mu      sync.Mutex // protects fields below
+	waiting bool       // waiting for next message
+	busy    int        // amount of calls in progress
+}
+
+// newTimeoutReader returns nil if conn doesn't support deadlines or
+// timeouts are not configured.
+func newTimeoutReader(conn io.Reader, o *options) *timeoutReader {
+	d, ok := conn.(deadliner)
+	if !ok || o.idleTimeout <= 0 && o.readTimeout <= 0 {
+		return nil
+	}
+	return &timeoutReader{r: conn, d: d, idle: o.idleTimeout, read: o.readTimeout}
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.mu.Lock()
+		if r.waiting {
+			r.waiting = false
+			r.update()
+		}
+		r.mu.Unlock()
+	}
+	return n, err
+}
+
+// wait must be called before reading next message.
+func (r *timeoutReader) wait() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waiting = true
+	r.update()
+}
+
+// setBusy must be called when amount of calls in progress changes.
+func (r *timeoutReader) setBusy(n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if (r.busy == 0) != (n == 0) {
+		r.busy = n
+		r.update()
+	}
+	r.busy = n
+}
+
+func (r *timeoutReader) update() {
+	timeout := r.read
+	if r.waiting && r.busy > 0 {
+		timeout = 0
+	} else if r.waiting {
+		timeout = r.idle
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	_ = r.d.SetReadDeadline(deadline)
+}
+
+// timeoutWriter sets write deadline on conn before each write and closes
+// conn if write won't complete in time, because it's unknown how much of
+// message was written.
+type timeoutWriter struct {
+	w       io.Writer
+	d       deadliner
+	c       io.Closer
+	timeout time.Duration
+}
+
+// newTimeoutWriter returns conn if it doesn't support deadlines or
+// timeout is not configured.
+func newTimeoutWriter(conn io.WriteCloser, o *options) io.Writer {
+	d, ok := conn.(deadliner)
+	if !ok || o.writeTimeout <= 0 {
+		return conn
+	}
+	return &timeoutWriter{w: conn, d: d, c: conn, timeout: o.writeTimeout}
+}
+
+func (w *timeoutWriter) Write(p []byte) (int, error) {
+	_ = w.d.SetWriteDeadline(time.Now().Add(w.timeout))
+	n, err := w.w.Write(p)
+	if isTimeout(err) {
+		_ = w.c.Close()
+	}
+	return n, err
+}
+
+// isTimeout returns true if err is caused by exceeded deadline.
+func isTimeout(err error) bool {
+	return err != nil && errors.Is(err, os.ErrDeadlineExceeded)
+}
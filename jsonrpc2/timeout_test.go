@@ -0,0 +1,219 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// TimeoutSvc is an RPC service for testing.
+type TimeoutSvc struct{}
+
+// Sleep sleeps given amount of milliseconds.
+func (TimeoutSvc) Sleep(ms [1]int, res *int) error {
+	time.Sleep(time.Duration(ms[0]) * time.Millisecond)
+	*res = ms[0]
+	return nil
+}
+
+func serveTimeout(opts ...jsonrpc2.Option) (cli net.Conn, done chan struct{}) {
+	srv := rpc.NewServer()
+	srv.Register(TimeoutSvc{})
+	cli, conn := net.Pipe()
+	done = make(chan struct{})
+	go func() {
+		srv.ServeCodec(jsonrpc2.NewServerCodec(conn, srv, opts...))
+		close(done)
+	}()
+	return cli, done
+}
+
+func waitClosed(t *testing.T, done chan struct{}, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("connection is not closed after %v", timeout)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	cli, done := serveTimeout(jsonrpc2.WithIdleTimeout(100 * time.Millisecond))
+	defer cli.Close()
+	client := jsonrpc2.NewClient(cli)
+	defer client.Close()
+
+	var res int
+	if err := client.Call("TimeoutSvc.Sleep", [1]int{300}, &res); err != nil || res != 300 {
+		t.Errorf("call longer than idle timeout: %d, %v", res, err)
+	}
+	select {
+	case <-done:
+		t.Fatal("connection closed too early")
+	case <-time.After(50 * time.Millisecond):
+	}
+	waitClosed(t, done, time.Second)
+	if err := client.Call("TimeoutSvc.Sleep", [1]int{0}, &res); err == nil {
+		t.Errorf("call after idle timeout: %v", err)
+	}
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	cli, done := serveTimeout(jsonrpc2.WithReadTimeout(100 * time.Millisecond))
+	defer cli.Close()
+	go io.Copy(ioutil.Discard, cli)
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := cli.Write([]byte(`{"jsonrpc":"2.0","id":0,"method":"TimeoutSvc.Sleep","params":[0]}`)); err != nil {
+		t.Fatalf("read timeout before message: %v", err)
+	}
+	if _, err := cli.Write([]byte(`{"jsonrpc":"2.0",`)); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, done, time.Second)
+}
+
+func TestServerWriteTimeout(t *testing.T) {
+	cli, done := serveTimeout(jsonrpc2.WithWriteTimeout(100 * time.Millisecond))
+	defer cli.Close()
+
+	if _, err := cli.Write([]byte(`{"jsonrpc":"2.0","id":0,"method":"TimeoutSvc.Sleep","params":[0]}`)); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, done, time.Second)
+	if _, err := cli.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() = %v, want EOF", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	cli, done := serveTimeout()
+	client := jsonrpc2.NewClient(cli, jsonrpc2.WithIdleTimeout(100*time.Millisecond))
+	defer client.Close()
+
+	var res int
+	if err := client.Call("TimeoutSvc.Sleep", [1]int{200}, &res); err != nil || res != 200 {
+		t.Errorf("call longer than idle timeout: %d, %v", res, err)
+	}
+	waitClosed(t, done, time.Second)
+	if err := client.Call("TimeoutSvc.Sleep", [1]int{0}, &res); err != rpc.ErrShutdown {
+		t.Errorf("call after idle timeout: %v", err)
+	}
+
+	cli, conn := net.Pipe()
+	defer conn.Close()
+	client = jsonrpc2.NewClient(cli, jsonrpc2.WithWriteTimeout(100*time.Millisecond))
+	defer client.Close()
+	if err := client.Call("TimeoutSvc.Sleep", [1]int{0}, &res); err == nil {
+		t.Errorf("call without reader succeeded")
+	}
+}
+
+type TimeoutArg struct{ jsonrpc2.Ctx }
+
+// Deadline returns true if call has a deadline.
+func (TimeoutSvc) Deadline(arg TimeoutArg, res *bool) error {
+	_, *res = arg.Context().Deadline()
+	return nil
+}
+
+func TestCallTimeoutStream(t *testing.T) {
+	cli, _ := serveTimeout(jsonrpc2.WithCallTimeout(jsonrpc2.CallTimeout{Timeout: 50 * time.Millisecond}))
+	defer cli.Close()
+	r := bufio.NewReader(cli)
+
+	start := time.Now()
+	cli.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"TimeoutSvc.Sleep","params":[200]}`))
+	want := `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"call timeout","data":{"timeout":0.05}}}`
+	if got, _ := r.ReadString('\n'); strings.TrimSpace(got) != want {
+		t.Errorf("\nwant: %s\ngot:  %s", want, got)
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Errorf("timeout error was sent after %v", d)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	cli.Write([]byte(`{"jsonrpc":"2.0","id":2,"method":"TimeoutSvc.Deadline"}`))
+	want = `{"jsonrpc":"2.0","id":2,"result":true}`
+	if got, _ := r.ReadString('\n'); strings.TrimSpace(got) != want {
+		t.Errorf("\nwant: %s\ngot:  %s", want, got)
+	}
+}
+
+func TestCallTimeoutOverride(t *testing.T) {
+	cli, _ := serveTimeout(
+		jsonrpc2.WithCallTimeout(jsonrpc2.CallTimeout{Timeout: 50 * time.Millisecond}),
+		jsonrpc2.WithCallTimeout(jsonrpc2.CallTimeout{
+			Timeout: 150 * time.Millisecond,
+			Methods: []string{"*.Sleep"},
+			Error:   jsonrpc2.NewError(-32050, "too slow"),
+		}),
+		jsonrpc2.WithCallTimeout(jsonrpc2.CallTimeout{Methods: []string{"*.Deadline"}}),
+	)
+	client := jsonrpc2.NewClient(cli)
+	defer client.Close()
+
+	var res int
+	if err := client.Call("TimeoutSvc.Sleep", [1]int{100}, &res); err != nil {
+		t.Errorf("Sleep(100) = %v", err)
+	}
+	rpcerr := jsonrpc2.ServerError(client.Call("TimeoutSvc.Sleep", [1]int{300}, &res))
+	if rpcerr == nil || rpcerr.Code != -32050 {
+		t.Errorf("Sleep(300) = %v", rpcerr)
+	}
+	var deadline bool
+	if err := client.Call("TimeoutSvc.Deadline", nil, &deadline); err != nil || deadline {
+		t.Errorf("Deadline() = %v, %v", deadline, err)
+	}
+}
+
+func TestCallTimeoutHTTP(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(TimeoutSvc{})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv,
+		jsonrpc2.WithCallTimeout(jsonrpc2.CallTimeout{Timeout: 50 * time.Millisecond})))
+	defer ts.Close()
+
+	client := jsonrpc2.NewHTTPClient(ts.URL)
+	defer client.Close()
+	start := time.Now()
+	var res int
+	rpcerr := jsonrpc2.ServerError(client.Call("TimeoutSvc.Sleep", [1]int{500}, &res))
+	if rpcerr == nil || rpcerr.Code != -32000 {
+		t.Errorf("Sleep(500) = %v", rpcerr)
+	}
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("timeout error was sent after %v", d)
+	}
+
+	start = time.Now()
+	req, _ := http.NewRequest("POST", ts.URL, strings.NewReader(`[`+
+		`{"jsonrpc":"2.0","id":1,"method":"TimeoutSvc.Sleep","params":[500]},`+
+		`{"jsonrpc":"2.0","id":2,"method":"TimeoutSvc.Sleep","params":[0]}]`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	want := `[{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"call timeout","data":{"timeout":0.05}}},` +
+		`{"jsonrpc":"2.0","id":2,"result":0}]`
+	if got := strings.TrimSpace(string(buf)); got != want {
+		t.Errorf("\nwant: %s\ngot:  %s", want, got)
+	}
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("batch reply was sent after %v", d)
+	}
+}
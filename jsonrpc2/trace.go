@@ -0,0 +1,104 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	traceparentMeta   = "traceparent"
+)
+
+// SpanContext identifies span in a trace according to W3C Trace Context.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// IsValid returns true if both TraceID and SpanID are not zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent returns sc formatted as W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent parses W3C traceparent header value.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	var version, flags [1]byte
+	ok := len(s) >= 55 && s[2] == '-' && s[35] == '-' && s[52] == '-' &&
+		(len(s) == 55 || s[55] == '-') &&
+		decodeHex(version[:], s[:2]) && decodeHex(sc.TraceID[:], s[3:35]) &&
+		decodeHex(sc.SpanID[:], s[36:52]) && decodeHex(flags[:], s[53:55]) &&
+		version[0] != 0xff && (version[0] != 0 || len(s) == 55)
+	sc.Flags = flags[0]
+	if !ok || !sc.IsValid() {
+		return SpanContext{}, errors.New("invalid traceparent: " + s)
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) bool {
+	n, err := hex.Decode(dst, []byte(s))
+	return err == nil && n == len(dst)
+}
+
+// ContextWithSpanContext returns a copy of ctx with sc, which will be
+// propagated to server by client calls made with this ctx.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey, sc)
+}
+
+// SpanContextFromContext returns span context stored in ctx.
+//
+// Server provides span context received from client (or span context
+// of span started by Tracer) in request context.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey).(SpanContext)
+	return sc, ok
+}
+
+// Tracer is an interface for starting spans for calls made by client or
+// processed by server.
+type Tracer interface {
+	// Start starts span for call of given method. Span context of parent
+	// span (if any) is available using SpanContextFromContext(ctx).
+	// Returned ctx will be used by client to send request or by server
+	// to process request.
+	Start(ctx context.Context, side Side, method string) (context.Context, Span)
+}
+
+// Span is a span started by Tracer.
+type Span interface {
+	SpanContext() SpanContext
+	// End is called when call completes, err is nil on success.
+	End(err error)
+}
+
+// startSpan starts span using tracer (if it's not nil) and returns ctx
+// with span context to propagate.
+func startSpan(ctx context.Context, tracer Tracer, side Side, method string) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := tracer.Start(ctx, side, method)
+	return ContextWithSpanContext(ctx, span.SpanContext()), span
+}
+
+// endSpan ends span (if it's not nil) with given error.
+func endSpan(span Span, err *Error) {
+	switch {
+	case span == nil:
+	case err == nil:
+		span.End(nil)
+	default:
+		span.End(err)
+	}
+}
@@ -0,0 +1,177 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"sync"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// TraceSvc is an RPC service for testing.
+type TraceSvc struct{}
+
+type TraceArg struct{ jsonrpc2.Ctx }
+
+// Parent returns span context received in request context.
+func (*TraceSvc) Parent(arg TraceArg, res *string) error {
+	sc, _ := jsonrpc2.SpanContextFromContext(arg.Context())
+	*res = sc.Traceparent()
+	return nil
+}
+
+// Recorder is an in-memory jsonrpc2.Tracer.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+type RecordedSpan struct {
+	rec    *Recorder
+	Side   jsonrpc2.Side
+	Method string
+	Parent jsonrpc2.SpanContext
+	SC     jsonrpc2.SpanContext
+	Err    error
+	Ended  bool
+}
+
+func (r *Recorder) Start(ctx context.Context, side jsonrpc2.Side, method string) (context.Context, jsonrpc2.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parent, _ := jsonrpc2.SpanContextFromContext(ctx)
+	span := &RecordedSpan{rec: r, Side: side, Method: method, Parent: parent}
+	span.SC.TraceID = parent.TraceID
+	span.SC.Flags = parent.Flags
+	if !parent.IsValid() {
+		span.SC.TraceID[0] = byte(len(r.spans) + 1)
+	}
+	span.SC.SpanID[7] = byte(len(r.spans) + 1)
+	r.spans = append(r.spans, span)
+	return ctx, span
+}
+
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]RecordedSpan, len(r.spans))
+	for i := range r.spans {
+		spans[i] = *r.spans[i]
+		spans[i].rec = nil
+	}
+	return spans
+}
+
+func (s *RecordedSpan) SpanContext() jsonrpc2.SpanContext { return s.SC }
+
+func (s *RecordedSpan) End(err error) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.Err = err
+	s.Ended = true
+}
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		s     string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01", false},
+		{"", false},
+	}
+	for _, v := range cases {
+		sc, err := jsonrpc2.ParseTraceparent(v.s)
+		if v.valid != (err == nil) {
+			t.Errorf("ParseTraceparent(%q) = %v", v.s, err)
+		}
+		if err == nil && len(v.s) == 55 && sc.Traceparent() != v.s {
+			t.Errorf("Traceparent() = %q, want %q", sc.Traceparent(), v.s)
+		}
+	}
+}
+
+func TestTraceHTTP(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&TraceSvc{})
+	srvRec, cliRec := &Recorder{}, &Recorder{}
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv, jsonrpc2.WithTracer(srvRec)))
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL, jsonrpc2.WithTracer(cliRec))
+	defer client.Close()
+
+	parent, _ := jsonrpc2.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := jsonrpc2.ContextWithSpanContext(context.Background(), parent)
+	var got string
+	if err := client.CallContext(ctx, "TraceSvc.Parent", nil, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CallContext(ctx, "TraceSvc.Missing", nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	cliSpans, srvSpans := cliRec.Spans(), srvRec.Spans()
+	if len(cliSpans) != 2 || len(srvSpans) != 2 {
+		t.Fatalf("got %d client and %d server spans", len(cliSpans), len(srvSpans))
+	}
+	for i, method := range []string{"TraceSvc.Parent", "TraceSvc.Missing"} {
+		cli, srv := cliSpans[i], srvSpans[i]
+		if cli.Side != jsonrpc2.ClientSide || cli.Method != method || cli.Parent != parent || !cli.Ended {
+			t.Errorf("client span %d: %+v", i, cli)
+		}
+		if srv.Side != jsonrpc2.ServerSide || srv.Method != method || srv.Parent != cli.SC || !srv.Ended {
+			t.Errorf("server span %d: %+v", i, srv)
+		}
+		if cli.SC.TraceID != parent.TraceID {
+			t.Errorf("client span %d: trace id %x, want %x", i, cli.SC.TraceID, parent.TraceID)
+		}
+	}
+	if got != srvSpans[0].SC.Traceparent() {
+		t.Errorf("handler got %q, want %q", got, srvSpans[0].SC.Traceparent())
+	}
+	if cliSpans[0].Err != nil || srvSpans[0].Err != nil {
+		t.Errorf("got errors %v, %v", cliSpans[0].Err, srvSpans[0].Err)
+	}
+	for _, span := range []RecordedSpan{cliSpans[1], srvSpans[1]} {
+		if err, ok := span.Err.(*jsonrpc2.Error); !ok || err.Code != -32601 {
+			t.Errorf("%s span error = %v", span.Side, span.Err)
+		}
+	}
+}
+
+func TestTraceMetaMember(t *testing.T) {
+	srv := rpc.NewServer()
+	srv.Register(&TraceSvc{})
+	cli, srvConn := net.Pipe()
+	go srv.ServeCodec(jsonrpc2.NewServerCodec(srvConn, srv, jsonrpc2.WithMetaMember("_meta")))
+	client := jsonrpc2.NewClient(cli, jsonrpc2.WithMetaMember("_meta"))
+	defer client.Close()
+
+	var got string
+	if err := client.Call("TraceSvc.Parent", nil, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (jsonrpc2.SpanContext{}).Traceparent(); got != want {
+		t.Errorf("without span context got %q, want %q", got, want)
+	}
+
+	parent, _ := jsonrpc2.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := jsonrpc2.ContextWithSpanContext(context.Background(), parent)
+	if err := client.CallContext(ctx, "TraceSvc.Parent", nil, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != parent.Traceparent() {
+		t.Errorf("got %q, want %q", got, parent.Traceparent())
+	}
+}
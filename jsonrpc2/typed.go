@@ -0,0 +1,99 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"net/rpc"
+	"sync"
+)
+
+// handlerMethod is a method name used by RPC services registered by
+// Handle, it's appended to name of called method by server codec.
+const handlerMethod = ".Call"
+
+// Caller is an interface implemented by Client and Pool.
+type Caller interface {
+	CallContext(ctx context.Context, serviceMethod string, args, reply interface{}) error
+}
+
+// Call invokes the named function with typed params and result.
+//
+// Returned error is either *Error, rpc.ErrShutdown, io.ErrUnexpectedEOF
+// or context error.
+func Call[Req, Resp any](ctx context.Context, client Caller, method string, req Req) (Resp, error) {
+	var resp Resp
+	err := typedError(client.CallContext(ctx, method, req, &resp))
+	return resp, err
+}
+
+// Notify sends notification with typed params using Client, Pool or
+// Notifier provided by NotifierFromContext.
+func Notify[Req any](n Notifier, method string, params Req) error {
+	return n.Notify(method, params)
+}
+
+// Await is a typed version of Future.Await.
+func Await[Resp any](ctx context.Context, f *Future) (Resp, error) {
+	var resp Resp
+	err := f.Await(ctx, &resp)
+	return resp, err
+}
+
+// HandlerArgs is a param type of RPC method registered by Handle.
+// It implements WithContext.
+type HandlerArgs[Req any] struct {
+	Ctx
+	Params Req
+}
+
+// UnmarshalJSON unmarshals request params into Params.
+func (a *HandlerArgs[Req]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &a.Params)
+}
+
+type handler[Req, Resp any] struct {
+	fn func(context.Context, Req) (Resp, error)
+}
+
+// Call is a RPC method which calls handler's function.
+func (h *handler[Req, Resp]) Call(args HandlerArgs[Req], reply *Resp) error {
+	resp, err := h.fn(args.Context(), args.Params)
+	if err != nil {
+		return err
+	}
+	*reply = resp
+	return nil
+}
+
+type handlerKey struct {
+	srv  *rpc.Server
+	name string
+}
+
+var handlers sync.Map //nolint:gochecknoglobals // handlerKey -> struct{}
+
+// Handle registers fn as RPC method with given name (like "Svc.Method")
+// in srv. If srv is nil then rpc.DefaultServer will be used.
+//
+// Resp must be exported or builtin type, just like reply type of usual
+// RPC methods. RPC method registered by Handle is available only using
+// JSON-RPC 2.0 server codec.
+func Handle[Req, Resp any](srv *rpc.Server, name string, fn func(ctx context.Context, req Req) (Resp, error)) error {
+	if srv == nil {
+		srv = rpc.DefaultServer
+	}
+	if err := srv.RegisterName(name, &handler[Req, Resp]{fn: fn}); err != nil {
+		return err
+	}
+	handlers.Store(handlerKey{srv, name}, struct{}{})
+	return nil
+}
+
+// handlerMethodName returns net/rpc method name for method registered
+// by Handle or method as is.
+func handlerMethodName(srv *rpc.Server, method string) string {
+	if _, ok := handlers.Load(handlerKey{srv, method}); ok {
+		return method + handlerMethod
+	}
+	return method
+}
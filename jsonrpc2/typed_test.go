@@ -0,0 +1,72 @@
+// nolint:errcheck
+package jsonrpc2_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/rpc"
+	"testing"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+type TypedReq struct {
+	A, B int
+}
+
+type TypedResp struct {
+	Sum    int
+	HasCtx bool
+}
+
+func TestTyped(t *testing.T) {
+	srv := rpc.NewServer()
+	notified := make(chan TypedReq, 1)
+	err := jsonrpc2.Handle(srv, "Typed.Sum", func(ctx context.Context, req TypedReq) (TypedResp, error) {
+		return TypedResp{Sum: req.A + req.B, HasCtx: jsonrpc2.HTTPRequestFromContext(ctx) != nil}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonrpc2.Handle(srv, "Typed.Fail", func(ctx context.Context, req []int) (int, error) {
+		return 0, jsonrpc2.NewError(42, "fail")
+	})
+	jsonrpc2.Handle(srv, "Typed.Notify", func(ctx context.Context, req TypedReq) (struct{}, error) {
+		notified <- req
+		return struct{}{}, nil
+	})
+	ts := httptest.NewServer(jsonrpc2.HTTPHandler(srv))
+	defer ts.Close()
+	client := jsonrpc2.NewHTTPClient(ts.URL)
+	defer client.Close()
+	ctx := context.Background()
+
+	resp, err := jsonrpc2.Call[TypedReq, TypedResp](ctx, client, "Typed.Sum", TypedReq{A: 3, B: 5})
+	if want := (TypedResp{Sum: 8, HasCtx: true}); err != nil || resp != want {
+		t.Errorf("Call() = %v, %v, want = %v, nil", resp, err, want)
+	}
+
+	_, err = jsonrpc2.Call[[]int, int](ctx, client, "Typed.Fail", []int{1})
+	var e *jsonrpc2.Error
+	if !errors.As(err, &e) || e.Code != 42 {
+		t.Errorf("Call(), err = %v, want code 42", err)
+	}
+
+	_, err = jsonrpc2.Call[TypedReq, int](ctx, client, "Typed.Missing", TypedReq{})
+	if !errors.As(err, &e) || e.Code != -32601 {
+		t.Errorf("Call(), err = %v, want code -32601", err)
+	}
+
+	f := client.Async(ctx, "Typed.Sum", TypedReq{A: 1, B: 2})
+	if resp, err := jsonrpc2.Await[TypedResp](ctx, f); err != nil || resp.Sum != 3 {
+		t.Errorf("Await() = %v, %v, want = 3, nil", resp.Sum, err)
+	}
+
+	if err := jsonrpc2.Notify(client, "Typed.Notify", TypedReq{A: 1}); err != nil {
+		t.Errorf("Notify(), err = %v", err)
+	}
+	if req := <-notified; req.A != 1 {
+		t.Errorf("notified = %v", req)
+	}
+}